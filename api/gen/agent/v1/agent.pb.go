@@ -22,9 +22,11 @@ const (
 )
 
 type ChatRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Model         string                 `protobuf:"bytes,1,opt,name=model,proto3" json:"model,omitempty"`
-	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"` // Context could be added here later (e.g. user_id, conversation_id)
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Model   string                 `protobuf:"bytes,1,opt,name=model,proto3" json:"model,omitempty"`
+	Content string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	// Correlates the stream with the client request (used for logging/tracing)
+	RequestId     string `protobuf:"bytes,3,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"` // Context could be added here later (e.g. user_id, conversation_id)
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -73,11 +75,20 @@ func (x *ChatRequest) GetContent() string {
 	return ""
 }
 
+func (x *ChatRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
 type ChatResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Content       string                 `protobuf:"bytes,1,opt,name=content,proto3" json:"content,omitempty"`
-	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`   // "text" or "reasoning" (for thinking models)
-	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"` // Empty if success
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`                                     // "text" or "reasoning" (for thinking models)
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`                                   // Empty if success
+	FinishReason  string                 `protobuf:"bytes,4,opt,name=finish_reason,json=finishReason,proto3" json:"finish_reason,omitempty"` // Set on the final response of a stream
+	Usage         *Usage                 `protobuf:"bytes,5,opt,name=usage,proto3" json:"usage,omitempty"`                                   // Set on the final response of a stream if the provider reports it
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -133,21 +144,103 @@ func (x *ChatResponse) GetError() string {
 	return ""
 }
 
+func (x *ChatResponse) GetFinishReason() string {
+	if x != nil {
+		return x.FinishReason
+	}
+	return ""
+}
+
+func (x *ChatResponse) GetUsage() *Usage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
+type Usage struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	PromptTokens     int32                  `protobuf:"varint,1,opt,name=prompt_tokens,json=promptTokens,proto3" json:"prompt_tokens,omitempty"`
+	CompletionTokens int32                  `protobuf:"varint,2,opt,name=completion_tokens,json=completionTokens,proto3" json:"completion_tokens,omitempty"`
+	TotalTokens      int32                  `protobuf:"varint,3,opt,name=total_tokens,json=totalTokens,proto3" json:"total_tokens,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Usage) Reset() {
+	*x = Usage{}
+	mi := &file_api_proto_agent_v1_agent_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Usage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Usage) ProtoMessage() {}
+
+func (x *Usage) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_agent_v1_agent_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Usage.ProtoReflect.Descriptor instead.
+func (*Usage) Descriptor() ([]byte, []int) {
+	return file_api_proto_agent_v1_agent_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Usage) GetPromptTokens() int32 {
+	if x != nil {
+		return x.PromptTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetCompletionTokens() int32 {
+	if x != nil {
+		return x.CompletionTokens
+	}
+	return 0
+}
+
+func (x *Usage) GetTotalTokens() int32 {
+	if x != nil {
+		return x.TotalTokens
+	}
+	return 0
+}
+
 var File_api_proto_agent_v1_agent_proto protoreflect.FileDescriptor
 
 const file_api_proto_agent_v1_agent_proto_rawDesc = "" +
 	"\n" +
-	"\x1eapi/proto/agent/v1/agent.proto\x12\bagent.v1\"=\n" +
+	"\x1eapi/proto/agent/v1/agent.proto\x12\bagent.v1\"\\\n" +
 	"\vChatRequest\x12\x14\n" +
 	"\x05model\x18\x01 \x01(\tR\x05model\x12\x18\n" +
-	"\acontent\x18\x02 \x01(\tR\acontent\"R\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x03 \x01(\tR\trequestId\"\x9e\x01\n" +
 	"\fChatResponse\x12\x18\n" +
 	"\acontent\x18\x01 \x01(\tR\acontent\x12\x12\n" +
 	"\x04type\x18\x02 \x01(\tR\x04type\x12\x14\n" +
-	"\x05error\x18\x03 \x01(\tR\x05error2M\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12#\n" +
+	"\rfinish_reason\x18\x04 \x01(\tR\ffinishReason\x12%\n" +
+	"\x05usage\x18\x05 \x01(\v2\x0f.agent.v1.UsageR\x05usage\"|\n" +
+	"\x05Usage\x12#\n" +
+	"\rprompt_tokens\x18\x01 \x01(\x05R\fpromptTokens\x12+\n" +
+	"\x11completion_tokens\x18\x02 \x01(\x05R\x10completionTokens\x12!\n" +
+	"\ftotal_tokens\x18\x03 \x01(\x05R\vtotalTokens2M\n" +
 	"\fAgentService\x12=\n" +
 	"\n" +
-	"ChatStream\x12\x15.agent.v1.ChatRequest\x1a\x16.agent.v1.ChatResponse0\x01B%Z#ai-gateway/api/gen/agent/v1;agentv1b\x06proto3"
+	"ChatStream\x12\x15.agent.v1.ChatRequest\x1a\x16.agent.v1.ChatResponse0\x01B<Z:github.com/yeliheng/go-ai-gateway/api/gen/agent/v1;agentv1b\x06proto3"
 
 var (
 	file_api_proto_agent_v1_agent_proto_rawDescOnce sync.Once
@@ -161,19 +254,21 @@ func file_api_proto_agent_v1_agent_proto_rawDescGZIP() []byte {
 	return file_api_proto_agent_v1_agent_proto_rawDescData
 }
 
-var file_api_proto_agent_v1_agent_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_api_proto_agent_v1_agent_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
 var file_api_proto_agent_v1_agent_proto_goTypes = []any{
 	(*ChatRequest)(nil),  // 0: agent.v1.ChatRequest
 	(*ChatResponse)(nil), // 1: agent.v1.ChatResponse
+	(*Usage)(nil),        // 2: agent.v1.Usage
 }
 var file_api_proto_agent_v1_agent_proto_depIdxs = []int32{
-	0, // 0: agent.v1.AgentService.ChatStream:input_type -> agent.v1.ChatRequest
-	1, // 1: agent.v1.AgentService.ChatStream:output_type -> agent.v1.ChatResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	2, // 0: agent.v1.ChatResponse.usage:type_name -> agent.v1.Usage
+	0, // 1: agent.v1.AgentService.ChatStream:input_type -> agent.v1.ChatRequest
+	1, // 2: agent.v1.AgentService.ChatStream:output_type -> agent.v1.ChatResponse
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_api_proto_agent_v1_agent_proto_init() }
@@ -187,7 +282,7 @@ func file_api_proto_agent_v1_agent_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_proto_agent_v1_agent_proto_rawDesc), len(file_api_proto_agent_v1_agent_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   3,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
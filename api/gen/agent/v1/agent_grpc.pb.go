@@ -57,7 +57,7 @@ func (c *agentServiceClient) ChatStream(ctx context.Context, in *ChatRequest, op
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type AgentService_ChatStreamClient = grpc.ServerStreamingClient[ChatResponse]
 
-// AgentServiceServer is the biz API for AgentService service.
+// AgentServiceServer is the server API for AgentService service.
 // All implementations must embed UnimplementedAgentServiceServer
 // for forward compatibility.
 type AgentServiceServer interface {
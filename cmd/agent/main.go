@@ -7,6 +7,7 @@ import (
 	"github.com/yeliheng/go-ai-gateway/api/gen/agent/v1"
 	"github.com/yeliheng/go-ai-gateway/common/config"
 	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/shutdown"
 	"github.com/yeliheng/go-ai-gateway/internal/provider"
 	agentService "github.com/yeliheng/go-ai-gateway/internal/service/agent"
 	"github.com/yeliheng/go-ai-gateway/pkg/telemetry"
@@ -34,11 +35,10 @@ func main() {
 	if jaegerAddr == "" {
 		logger.Log.Fatal("Jaeger address is required but missing")
 	}
-	shutdown, err := telemetry.InitTracer("agent-service", jaegerAddr)
+	shutdownTracer, err := telemetry.InitTracer("agent-service", jaegerAddr)
 	if err != nil {
 		logger.Log.Error("Failed to init tracer", zap.Error(err))
-	} else {
-		defer shutdown(nil)
+		shutdownTracer = nil
 	}
 
 	port := config.GlobalConfig.Services.Agent.Port
@@ -58,7 +58,5 @@ func main() {
 	reflection.Register(s)
 
 	logger.Log.Info("Agent Service listening", zap.String("port", port))
-	if err := s.Serve(lis); err != nil {
-		logger.Log.Fatal("Failed to serve", zap.Error(err))
-	}
+	shutdown.ServeGRPC("Agent Service", s, lis, shutdownTracer)
 }
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
 	"github.com/yeliheng/go-ai-gateway/common/config"
 	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/shutdown"
 	"github.com/yeliheng/go-ai-gateway/internal/cache"
 	"github.com/yeliheng/go-ai-gateway/internal/database"
 	identityService "github.com/yeliheng/go-ai-gateway/internal/service/identity"
@@ -29,17 +34,30 @@ func main() {
 
 	// Connect to Database
 	database.InitDB()
+
+	// identity migrate [up | down [n] | status]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			logger.Log.Fatal("Migration failed", zap.Error(err))
+		}
+		return
+	}
+	if config.GlobalConfig.Database.AutoMigrate {
+		if _, err := database.MigrateUp(context.Background()); err != nil {
+			logger.Log.Fatal("Migration failed", zap.Error(err))
+		}
+	}
+
 	cache.InitRedis()
 
 	jaegerAddr := config.GlobalConfig.Services.Jaeger.Addr
 	if jaegerAddr == "" {
 		logger.Log.Fatal("Jaeger address is required but missing")
 	}
-	shutdown, err := telemetry.InitTracer("identity-service", jaegerAddr)
+	shutdownTracer, err := telemetry.InitTracer("identity-service", jaegerAddr)
 	if err != nil {
 		logger.Log.Error("Failed to init tracer", zap.Error(err))
-	} else {
-		defer shutdown(nil)
+		shutdownTracer = nil
 	}
 
 	port := config.GlobalConfig.Services.Identity.Port
@@ -60,7 +78,50 @@ func main() {
 	reflection.Register(s)
 
 	logger.Log.Info("Identity Service listening", zap.String("port", port))
-	if err := s.Serve(lis); err != nil {
-		logger.Log.Fatal("Failed to serve", zap.Error(err))
+	shutdown.ServeGRPC("Identity Service", s, lis, shutdownTracer)
+}
+
+func migrate(args []string) error {
+	ctx := context.Background()
+	cmd := "up"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	switch cmd {
+	case "up":
+		n, err := database.MigrateUp(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Log.Info("Migrations applied", zap.Int("count", n))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		n, err := database.MigrateDown(ctx, steps)
+		if err != nil {
+			return err
+		}
+		logger.Log.Info("Migrations rolled back", zap.Int("count", n))
+	case "status":
+		status, err := database.GetMigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, use up, down [n] or status", cmd)
 	}
+	return nil
 }
@@ -15,7 +15,9 @@ type Config struct {
 	Database  DatabaseConfig
 	Redis     RedisConfig
 	JWT       JWTConfig
+	OIDC      OIDCConfig
 	RateLimit RateLimitConfig
+	WebSocket WebSocketConfig
 }
 
 type ServicesConfig struct {
@@ -51,13 +53,77 @@ type RuleConfig struct {
 	Window string // duration string
 }
 
+type WebSocketConfig struct {
+	NodeID string // identifies this replica in the cluster session registry, generated if empty
+
+	// Handshake security
+	AllowedOrigins    []string // "*" allows any origin, "https://*.example.com" matches subdomains; empty means same origin only
+	DisableQueryToken bool     // reject tokens passed as ?token=, they end up in proxy logs (biz masks them in its own)
+	AuthTimeout       string   // duration string, deadline for the first-message auth frame
+
+	// Connection settings, zero values fall back to defaults
+	ReadBufferSize    int
+	WriteBufferSize   int
+	EnableCompression bool   // negotiate permessage-deflate
+	CompressionLevel  *int   // flate level, -2..9; unset means 1 (best speed)
+	MaxMessageSize    int64  // read limit in bytes
+	WriteWait         string // duration string
+	PongWait          string // duration string
+	PingPeriod        string // duration string, must be less than PongWait
+
+	// Connection limits, 0 means unlimited
+	MaxConns        int    // sockets per replica, including ones still waiting for their auth frame
+	MaxConnsPerUser int    // across the cluster
+	MaxConnsPerIP   int    // per replica
+	LimitPolicy     string // "reject" (default) or "evict_oldest"
+
+	// Backpressure for slow consumers
+	MaxBufferedBytes  int    // per-client send buffer, default 1MB, negative means unlimited
+	SlowClientTimeout string // duration string, disconnect clients whose buffer isn't drained for this long
+
+	// Resumable streams
+	ResumeTTL   string // duration string, how long stream output is kept in Redis ("0s" disables buffering)
+	ResumeGrace string // duration string, how long a stream keeps running after its client disconnects
+}
+
 type AppConfig struct {
-	Name string
-	Port string
+	Name            string
+	Port            string
+	ShutdownTimeout string // duration string, how long to wait for in-flight requests on shutdown
 }
 
 type AuthConfig struct {
-	Tokens []string
+	Tokens             []string
+	ValidationCacheTTL string // duration string
+	Lockout            LockoutConfig
+	Password           PasswordConfig
+}
+
+type PasswordConfig struct {
+	MinLength        int
+	BreachedListFile string // One password, or SHA-1 hash as published by HIBP, per line
+	ResetTokenTTL    string // duration string
+	ResetURL         string // Page the reset link points at, gets ?token=
+	Notifier         string // How reset links are delivered: "log" or "smtp"
+	SMTP             SMTPConfig
+}
+
+type SMTPConfig struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// LockoutConfig limits password guessing per username. After FreeAttempts
+// failures each attempt has to wait, doubling from Delay; MaxAttempts
+// failures within Window lock the username for Duration.
+type LockoutConfig struct {
+	FreeAttempts int
+	MaxAttempts  int
+	Delay        string // duration string
+	Window       string // duration string
+	Duration     string // duration string
 }
 
 type OpenAIConfig struct {
@@ -73,6 +139,9 @@ type DatabaseConfig struct {
 	User     string
 	Password string
 	DBName   string
+	// Apply pending migrations when the identity service starts, otherwise
+	// run "identity migrate"
+	AutoMigrate bool
 }
 
 type RedisConfig struct {
@@ -82,8 +151,34 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string
-	ExpiryDays int
+	SigningKey     string // Key ID new tokens are signed with, first private key if empty
+	Keys           []JWTKeyConfig
+	AllowEphemeral bool   // Sign with a throwaway key when no key is configured, development only
+	ExpiryDays     int    // Refresh token lifetime when RefreshTTL is unset
+	AccessTTL      string // duration string
+	RefreshTTL     string // duration string
+}
+
+// OIDCConfig configures single sign-on with an external OpenID Connect provider.
+type OIDCConfig struct {
+	Enabled      bool
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // Must point at /auth/oidc/callback of the gateway
+	Scopes       []string // "openid" is always requested
+	DefaultRole  string   // Role of users provisioned on first login
+	// Where the browser is sent with the tokens in the URL fragment
+	PostLoginRedirect string
+}
+
+// JWTKeyConfig is a PEM encoded RSA (RS256), ECDSA (ES256/384/512) or Ed25519
+// (EdDSA) key. Retired keys can be listed with only a public key, so tokens
+// they signed still verify until they expire.
+type JWTKeyConfig struct {
+	ID             string // Key ID (kid), published in the JWKS
+	PrivateKeyFile string // Signing key, the public key is derived from it
+	PublicKeyFile  string // Used only without a private key, for retired keys
 }
 
 var GlobalConfig Config
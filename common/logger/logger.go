@@ -23,3 +23,8 @@ func InitLogger() {
 	Log = zap.New(core, zap.AddCaller())
 	zap.ReplaceGlobals(Log)
 }
+
+// Audit records a security relevant event, e.g. an account lockout.
+func Audit(event string, fields ...zap.Field) {
+	Log.Named("audit").Warn(event, fields...)
+}
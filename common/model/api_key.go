@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix starts every API key, so they can't be mistaken for JWTs.
+const APIKeyPrefix = "sk-"
+
+// APIKey lets a user's programs authenticate without a password. Only a
+// SHA-256 hash of the key is stored; Prefix identifies it in listings.
+type APIKey struct {
+	gorm.Model
+	UserID     uint `gorm:"index"`
+	User       User
+	Name       string
+	Prefix     string
+	Hash       string   `gorm:"uniqueIndex"`
+	Scopes     []string `gorm:"serializer:json"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
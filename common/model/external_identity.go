@@ -0,0 +1,14 @@
+package model
+
+import "gorm.io/gorm"
+
+// ExternalIdentity links a user to an account at an external identity
+// provider, e.g. an OIDC issuer and the subject it assigned.
+type ExternalIdentity struct {
+	gorm.Model
+	Provider string `gorm:"uniqueIndex:idx_external_identity"`
+	Subject  string `gorm:"uniqueIndex:idx_external_identity"`
+	UserID   uint   `gorm:"index"`
+	User     User
+	Email    string
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type Permission struct {
+	gorm.Model
+	Name        string `gorm:"uniqueIndex"`
+	Description string
+}
+
+// Well-known permissions. A trailing "*" grants everything with that prefix,
+// e.g. "model:*" allows every model and "*" allows everything.
+const (
+	PermChatUse        = "chat:use"
+	PermAdminUsers     = "admin:users"
+	PermAdminBroadcast = "admin:broadcast"
+	PermAdminMetrics   = "admin:metrics"
+	PermModelAll       = "model:*"
+)
+
+// ModelPermission returns the permission needed to chat with a model.
+func ModelPermission(name string) string {
+	return "model:" + name
+}
+
+// Permissions is the set of permission names granted to a caller.
+type Permissions []string
+
+// Has reports whether perm is granted, directly or through a wildcard.
+func (p Permissions) Has(perm string) bool {
+	for _, granted := range p {
+		if granted == perm {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(granted, "*"); ok && strings.HasPrefix(perm, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersect returns the permissions granted by both p and other, taking
+// wildcards on either side into account.
+func (p Permissions) Intersect(other Permissions) Permissions {
+	var out Permissions
+	for _, perm := range p {
+		if other.Has(perm) {
+			out = append(out, perm)
+		}
+	}
+	for _, perm := range other {
+		if p.Has(perm) && !out.Has(perm) {
+			out = append(out, perm)
+		}
+	}
+	return out
+}
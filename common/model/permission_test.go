@@ -0,0 +1,113 @@
+package model
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPermissionsHas(t *testing.T) {
+	cases := []struct {
+		name    string
+		granted Permissions
+		perm    string
+		want    bool
+	}{
+		{"everything", Permissions{"*"}, "admin:users", true},
+		{"everything covers models", Permissions{"*"}, ModelPermission("gpt-4o"), true},
+		{"all models", Permissions{PermModelAll}, ModelPermission("gpt-4o"), true},
+		{"all models is not admin", Permissions{PermModelAll}, PermAdminUsers, false},
+		{"all models is not chat", Permissions{PermModelAll}, PermChatUse, false},
+		{"model prefix", Permissions{"model:gpt-*"}, ModelPermission("gpt-4o"), true},
+		{"model prefix mismatch", Permissions{"model:gpt-*"}, ModelPermission("claude"), false},
+		{"exact", Permissions{PermChatUse}, PermChatUse, true},
+		{"exact model", Permissions{ModelPermission("mock")}, ModelPermission("mock"), true},
+		{"other model", Permissions{ModelPermission("mock")}, ModelPermission("mock-2"), false},
+		{"no match", Permissions{PermChatUse, PermAdminMetrics}, PermAdminUsers, false},
+		{"prefix without wildcard", Permissions{"model:"}, ModelPermission("mock"), false},
+		{"wildcard only at the end", Permissions{"model:*:fast"}, "model:x:fast", false},
+		{"nothing granted", nil, PermChatUse, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.granted.Has(tc.perm); got != tc.want {
+				t.Fatalf("%v.Has(%q) = %v, want %v", tc.granted, tc.perm, got, tc.want)
+			}
+		})
+	}
+}
+
+// Permissions a caller could ask for, used to check that narrowing never
+// grants more than both sides.
+var probes = []string{
+	PermChatUse, PermAdminUsers, PermAdminBroadcast, PermAdminMetrics,
+	PermModelAll, "model:gpt-*",
+	ModelPermission("gpt-4o"), ModelPermission("gpt-4o-mini"), ModelPermission("mock"), ModelPermission("claude"),
+}
+
+func TestPermissionsIntersect(t *testing.T) {
+	cases := []struct {
+		name   string
+		role   Permissions
+		scopes Permissions
+		want   Permissions
+	}{
+		{
+			name:   "scope narrows everything",
+			role:   Permissions{"*"},
+			scopes: Permissions{PermChatUse, ModelPermission("mock")},
+			want:   Permissions{PermChatUse, ModelPermission("mock")},
+		},
+		{
+			name:   "scope narrows all models",
+			role:   Permissions{PermChatUse, PermModelAll},
+			scopes: Permissions{PermChatUse, ModelPermission("gpt-4o")},
+			want:   Permissions{PermChatUse, ModelPermission("gpt-4o")},
+		},
+		{
+			name:   "wildcard scope can't widen the role",
+			role:   Permissions{PermChatUse, ModelPermission("mock")},
+			scopes: Permissions{"*"},
+			want:   Permissions{PermChatUse, ModelPermission("mock")},
+		},
+		{
+			name:   "model wildcard scope can't widen the role",
+			role:   Permissions{PermChatUse, ModelPermission("mock")},
+			scopes: Permissions{PermChatUse, PermModelAll},
+			want:   Permissions{PermChatUse, ModelPermission("mock")},
+		},
+		{
+			name:   "scope outside the role",
+			role:   Permissions{PermChatUse, ModelPermission("mock")},
+			scopes: Permissions{PermAdminUsers, ModelPermission("gpt-4o")},
+			want:   nil,
+		},
+		{
+			name:   "both wildcards",
+			role:   Permissions{PermModelAll},
+			scopes: Permissions{"model:gpt-*"},
+			want:   Permissions{"model:gpt-*"},
+		},
+		{
+			name:   "no duplicates",
+			role:   Permissions{"*"},
+			scopes: Permissions{"*"},
+			want:   Permissions{"*"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.role.Intersect(tc.scopes)
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for _, perm := range probes {
+				if got.Has(perm) && !(tc.role.Has(perm) && tc.scopes.Has(perm)) {
+					t.Errorf("narrowed permissions grant %q, which the role or the scopes don't", perm)
+				}
+				if !got.Has(perm) && tc.role.Has(perm) && tc.scopes.Has(perm) {
+					t.Errorf("narrowed permissions lost %q", perm)
+				}
+			}
+		})
+	}
+}
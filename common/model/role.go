@@ -4,5 +4,6 @@ import "gorm.io/gorm"
 
 type Role struct {
 	gorm.Model
-	Name string `gorm:"uniqueIndex"`
+	Name        string       `gorm:"uniqueIndex"`
+	Permissions []Permission `gorm:"many2many:role_permissions;"`
 }
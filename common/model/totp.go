@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TOTP is a user's authenticator app enrollment. It only applies to logins
+// once confirmed with a valid code.
+type TOTP struct {
+	gorm.Model
+	UserID      uint `gorm:"uniqueIndex"`
+	Secret      string
+	ConfirmedAt *time.Time
+	// Last time step a code was accepted for, codes can't be used twice
+	LastStep int64
+	// SHA-256 hashes of the unused recovery codes
+	RecoveryCodes []string `gorm:"serializer:json"`
+}
+
+func (t *TOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
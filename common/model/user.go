@@ -1,11 +1,18 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
-	Username string `gorm:"uniqueIndex"`
+	Username string `gorm:"uniqueIndex:idx_users_username,where:deleted_at IS NULL"` // Free again once the user is deleted
 	Password string
+	Email    string `gorm:"index"`
 	RoleID   uint
 	Role     Role
+	// Disabled users can't log in, set by admins
+	DisabledAt *time.Time
 }
@@ -0,0 +1,75 @@
+// Package shutdown implements the graceful shutdown shared by the services.
+package shutdown
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// Notify returns a channel receiving the signals that stop a service.
+func Notify() <-chan os.Signal {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	return quit
+}
+
+// Context returns the deadline for a shutdown, App.ShutdownTimeout from now.
+func Context() (context.Context, context.CancelFunc) {
+	timeout, err := time.ParseDuration(config.GlobalConfig.App.ShutdownTimeout)
+	if err != nil {
+		timeout = 30 * time.Second
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// FlushTraces runs the tracer shutdown returned by telemetry.InitTracer, if any.
+func FlushTraces(ctx context.Context, shutdownTracer func(context.Context) error) {
+	if shutdownTracer == nil {
+		return
+	}
+	if err := shutdownTracer(ctx); err != nil {
+		logger.Log.Error("Failed to flush traces", zap.Error(err))
+	}
+}
+
+// ServeGRPC serves s on lis until SIGINT/SIGTERM. In-flight RPCs then get
+// until the shutdown deadline to finish before they are closed.
+func ServeGRPC(name string, s *grpc.Server, lis net.Listener, shutdownTracer func(context.Context) error) {
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			logger.Log.Fatal("Failed to serve", zap.Error(err))
+		}
+	}()
+
+	sig := <-Notify()
+	logger.Log.Info("Shutting down "+name, zap.String("signal", sig.String()))
+
+	ctx, cancel := Context()
+	defer cancel()
+
+	// Let in-flight RPCs finish, force close once the deadline passes
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		logger.Log.Warn("Graceful stop timed out, closing remaining RPCs")
+		s.Stop()
+	}
+
+	FlushTraces(ctx, shutdownTracer)
+	logger.Log.Info(name + " stopped")
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// LoginFailures are the recent failed logins of a username.
+type LoginFailures struct {
+	Count int
+	Last  time.Time
+}
+
+// Usernames are hashed, keys don't need escaping and dumps don't list them.
+func loginKey(prefix, username string) string {
+	sum := sha256.Sum256([]byte(username))
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+// Counts a failure and returns the new count. The window starts with the
+// first failure.
+const recordLoginFailure = `
+local n = redis.call('HINCRBY', KEYS[1], 'count', 1)
+redis.call('HSET', KEYS[1], 'last', ARGV[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return n
+`
+
+// GetLoginFailures returns the failures of a username within the window.
+func GetLoginFailures(ctx context.Context, username string) (*LoginFailures, error) {
+	res, err := RDB.HMGet(ctx, loginKey("login_failures:", username), "count", "last").Result()
+	if err != nil {
+		return nil, err
+	}
+	f := &LoginFailures{}
+	if s, ok := res[0].(string); ok {
+		f.Count, _ = strconv.Atoi(s)
+	}
+	if s, ok := res[1].(string); ok {
+		ms, _ := strconv.ParseInt(s, 10, 64)
+		f.Last = time.UnixMilli(ms)
+	}
+	return f, nil
+}
+
+// RecordLoginFailure counts a failed login and returns the failures so far.
+func RecordLoginFailure(ctx context.Context, username string, window time.Duration) (int, error) {
+	return RDB.Eval(ctx, recordLoginFailure, []string{loginKey("login_failures:", username)},
+		time.Now().UnixMilli(), window.Milliseconds()).Int()
+}
+
+// ClearLoginFailures forgets the failures after a successful login.
+func ClearLoginFailures(ctx context.Context, username string) error {
+	return RDB.Del(ctx, loginKey("login_failures:", username)).Err()
+}
+
+// LockLogin locks a username for d and clears its failures.
+func LockLogin(ctx context.Context, username string, d time.Duration) error {
+	pipe := RDB.TxPipeline()
+	pipe.Set(ctx, loginKey("login_lock:", username), 1, d)
+	pipe.Del(ctx, loginKey("login_failures:", username))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// LoginLockedFor returns how long a username stays locked, 0 if it isn't.
+func LoginLockedFor(ctx context.Context, username string) (time.Duration, error) {
+	ttl, err := RDB.PTTL(ctx, loginKey("login_lock:", username)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// -2 if there's no lock
+	return max(ttl, 0), nil
+}
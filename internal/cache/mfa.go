@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MFAChallenge is a login that passed the password check and waits for a
+// second factor.
+type MFAChallenge struct {
+	UserID    uint
+	IP        string
+	UserAgent string
+}
+
+// Counts an attempt on a challenge and returns {user_id, ip, user_agent}, or
+// nil if it doesn't exist or ran out of attempts (then it is deleted).
+const attemptMFAChallenge = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return nil
+end
+if redis.call('HINCRBY', KEYS[1], 'attempts', 1) > tonumber(ARGV[1]) then
+	redis.call('DEL', KEYS[1])
+	return nil
+end
+return redis.call('HMGET', KEYS[1], 'user_id', 'ip', 'user_agent')
+`
+
+func mfaKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "mfa:" + hex.EncodeToString(sum[:])
+}
+
+// SaveMFAChallenge stores a challenge under token for ttl.
+func SaveMFAChallenge(ctx context.Context, token string, ch *MFAChallenge, ttl time.Duration) error {
+	pipe := RDB.TxPipeline()
+	pipe.HSet(ctx, mfaKey(token), "user_id", ch.UserID, "ip", ch.IP, "user_agent", ch.UserAgent, "attempts", 0)
+	pipe.Expire(ctx, mfaKey(token), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// AttemptMFAChallenge returns the challenge for token, counting one of its
+// maxAttempts. It returns nil if the challenge is unknown, expired or used up.
+func AttemptMFAChallenge(ctx context.Context, token string, maxAttempts int) (*MFAChallenge, error) {
+	res, err := RDB.Eval(ctx, attemptMFAChallenge, []string{mfaKey(token)}, maxAttempts).Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	userID, _ := strconv.ParseUint(res[0].(string), 10, 64)
+	ip, _ := res[1].(string)
+	userAgent, _ := res[2].(string)
+	return &MFAChallenge{UserID: uint(userID), IP: ip, UserAgent: userAgent}, nil
+}
+
+// ConsumeMFAChallenge ends a challenge once the second factor checked out. It
+// returns false if another request got there first.
+func ConsumeMFAChallenge(ctx context.Context, token string) (bool, error) {
+	n, err := RDB.Del(ctx, mfaKey(token)).Result()
+	return n > 0, err
+}
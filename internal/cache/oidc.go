@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func oidcStateKey(state string) string {
+	return "oidc:state:" + state
+}
+
+// SaveOIDCState keeps the state of a pending SSO login until the provider
+// redirects back, on whichever replica that lands.
+func SaveOIDCState(ctx context.Context, state string, data []byte, ttl time.Duration) error {
+	return RDB.Set(ctx, oidcStateKey(state), data, ttl).Err()
+}
+
+// TakeOIDCState returns and deletes the state of a pending login, nil if it
+// is unknown or expired. Each state can be used once.
+func TakeOIDCState(ctx context.Context, state string) ([]byte, error) {
+	data, err := RDB.GetDel(ctx, oidcStateKey(state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return data, err
+}
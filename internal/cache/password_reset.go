@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func passwordResetKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "password_reset:" + hex.EncodeToString(sum[:])
+}
+
+// SavePasswordResetToken stores a reset token of a user for ttl.
+func SavePasswordResetToken(ctx context.Context, token string, userID uint, ttl time.Duration) error {
+	return RDB.Set(ctx, passwordResetKey(token), userID, ttl).Err()
+}
+
+// GetPasswordResetToken returns the user of a reset token without using it
+// up, 0 if the token is unknown or expired.
+func GetPasswordResetToken(ctx context.Context, token string) (uint, error) {
+	userID, err := RDB.Get(ctx, passwordResetKey(token)).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return uint(userID), err
+}
+
+// UsePasswordResetToken returns the user of a reset token and deletes it, 0
+// if the token is unknown or expired.
+func UsePasswordResetToken(ctx context.Context, token string) (uint, error) {
+	userID, err := RDB.GetDel(ctx, passwordResetKey(token)).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return uint(userID), err
+}
@@ -2,7 +2,6 @@ package cache
 
 import (
 	"context"
-	"errors"
 	"time"
 
 	"github.com/yeliheng/go-ai-gateway/common/config"
@@ -31,22 +30,3 @@ func InitRedis() {
 
 	logger.Log.Info("Redis connection established")
 }
-
-func SetToken(ctx context.Context, token string, userID uint, expiration time.Duration) error {
-	return RDB.Set(ctx, "token:"+token, userID, expiration).Err()
-}
-
-func GetToken(ctx context.Context, token string) (string, error) {
-	return RDB.Get(ctx, "token:"+token).Result()
-}
-
-func ValidateToken(ctx context.Context, token string) (bool, error) {
-	_, err := RDB.Get(ctx, "token:"+token).Result()
-	if errors.Is(err, redis.Nil) {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
-	}
-	return true, nil
-}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RefreshToken is the stored state of an opaque refresh token. Every token
+// rotated from the same login shares its session.
+type RefreshToken struct {
+	UserID    uint
+	SessionID string
+}
+
+// Marks a refresh token used and returns {user_id, session_id, use count},
+// or nil if the token doesn't exist.
+const useRefreshToken = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return nil
+end
+local used = redis.call('HINCRBY', KEYS[1], 'used', 1)
+return {redis.call('HGET', KEYS[1], 'user_id'), redis.call('HGET', KEYS[1], 'session_id'), used}
+`
+
+// Refresh tokens are stored hashed so a Redis dump doesn't leak usable tokens.
+func refreshKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "refresh:" + hex.EncodeToString(sum[:])
+}
+
+// SaveRefreshToken stores a refresh token of a session for ttl. Revoking the
+// session invalidates it.
+func SaveRefreshToken(ctx context.Context, token string, userID uint, sid string, ttl time.Duration) error {
+	pipe := RDB.TxPipeline()
+	pipe.HSet(ctx, refreshKey(token), "user_id", userID, "session_id", sid)
+	pipe.Expire(ctx, refreshKey(token), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// UseRefreshToken marks a refresh token as used. It returns nil if the token
+// is unknown or expired, and reused is true if it had been used before.
+func UseRefreshToken(ctx context.Context, token string) (rt *RefreshToken, reused bool, err error) {
+	res, err := RDB.Eval(ctx, useRefreshToken, []string{refreshKey(token)}).Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	userID, _ := strconv.ParseUint(res[0].(string), 10, 64)
+	rt = &RefreshToken{UserID: uint(userID), SessionID: res[1].(string)}
+	return rt, res[2].(int64) > 1, nil
+}
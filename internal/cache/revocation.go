@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// RevocationChannel carries Revocation events from the identity service to
+// every biz replica, so connections using revoked tokens can be closed.
+const RevocationChannel = "auth:revoked"
+
+// Revocation announces revoked tokens: one login session of a user, or all
+// of them when SessionID is empty.
+type Revocation struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+func PublishRevocation(ctx context.Context, r Revocation) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return RDB.Publish(ctx, RevocationChannel, data).Err()
+}
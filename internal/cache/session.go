@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Session is a login session. It lives as long as its refresh tokens and
+// records the ID (jti) of the one access token currently valid for it.
+//
+//	session:<sid>          hash with the fields below
+//	user_sessions:<user>   set of the user's session IDs
+type Session struct {
+	ID        string
+	UserID    uint
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+	LastSeen  time.Time
+}
+
+func sessionKey(sid string) string {
+	return "session:" + sid
+}
+
+func userSessionsKey(userID uint) string {
+	return "user_sessions:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// CreateSession stores a new session that expires after ttl unless extended.
+func CreateSession(ctx context.Context, s *Session, ttl time.Duration) error {
+	now := time.Now().Unix()
+	pipe := RDB.TxPipeline()
+	pipe.HSet(ctx, sessionKey(s.ID),
+		"user_id", s.UserID,
+		"ip", s.IP,
+		"user_agent", s.UserAgent,
+		"created_at", now,
+		"last_seen", now,
+	)
+	pipe.Expire(ctx, sessionKey(s.ID), ttl)
+	pipe.SAdd(ctx, userSessionsKey(s.UserID), s.ID)
+	pipe.Expire(ctx, userSessionsKey(s.UserID), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Sets the access token of a session and extends it, unless the session was
+// revoked in the meantime. Returns 1 if set.
+const setSessionToken = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'jti', ARGV[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+redis.call('EXPIRE', KEYS[2], ARGV[2])
+return 1
+`
+
+// SetSessionToken makes jti the session's only valid access token and
+// extends the session by ttl. It returns false if the session no longer
+// exists, so a revoked session is never brought back.
+func SetSessionToken(ctx context.Context, sid string, userID uint, jti string, ttl time.Duration) (bool, error) {
+	keys := []string{sessionKey(sid), userSessionsKey(userID)}
+	n, err := RDB.Eval(ctx, setSessionToken, keys, jti, int64(ttl/time.Second)).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Checks that a session exists and jti is its current access token, and
+// records the use. Returns 1 if valid.
+const validateSessionToken = `
+local jti = redis.call('HGET', KEYS[1], 'jti')
+if not jti or jti ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'last_seen', ARGV[2])
+return 1
+`
+
+// ValidateSessionToken reports whether an access token, identified by its
+// session and jti claims, hasn't been revoked or rotated out.
+func ValidateSessionToken(ctx context.Context, sid string, jti string) (bool, error) {
+	if sid == "" || jti == "" {
+		return false, nil
+	}
+	n, err := RDB.Eval(ctx, validateSessionToken, []string{sessionKey(sid)}, jti, time.Now().Unix()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// SessionActive reports whether a session hasn't been revoked or expired.
+func SessionActive(ctx context.Context, sid string) (bool, error) {
+	n, err := RDB.Exists(ctx, sessionKey(sid)).Result()
+	return n > 0, err
+}
+
+// GetSession returns a session, or nil if it doesn't exist.
+func GetSession(ctx context.Context, sid string) (*Session, error) {
+	fields, err := RDB.HGetAll(ctx, sessionKey(sid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	userID, _ := strconv.ParseUint(fields["user_id"], 10, 64)
+	createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	lastSeen, _ := strconv.ParseInt(fields["last_seen"], 10, 64)
+	return &Session{
+		ID:        sid,
+		UserID:    uint(userID),
+		IP:        fields["ip"],
+		UserAgent: fields["user_agent"],
+		CreatedAt: time.Unix(createdAt, 0),
+		LastSeen:  time.Unix(lastSeen, 0),
+	}, nil
+}
+
+// ListSessions returns the active sessions of a user, most recently used
+// first. Expired sessions are removed from the user's set on the way.
+func ListSessions(ctx context.Context, userID uint) ([]*Session, error) {
+	ids, err := RDB.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*Session, 0, len(ids))
+	for _, sid := range ids {
+		s, err := GetSession(ctx, sid)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			RDB.SRem(ctx, userSessionsKey(userID), sid)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+// DeleteSession revokes a session, its refresh tokens and its access token.
+func DeleteSession(ctx context.Context, sid string) error {
+	userID, err := RDB.HGet(ctx, sessionKey(sid), "user_id").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pipe := RDB.TxPipeline()
+	pipe.Del(ctx, sessionKey(sid))
+	pipe.SRem(ctx, "user_sessions:"+userID, sid)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// DeleteUserSessions revokes every session of a user and returns how many
+// were still active.
+func DeleteUserSessions(ctx context.Context, userID uint) (int, error) {
+	ids, err := RDB.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, sid := range ids {
+		keys = append(keys, sessionKey(sid))
+	}
+	revoked := 0
+	if len(keys) > 0 {
+		n, err := RDB.Del(ctx, keys...).Result()
+		if err != nil {
+			return 0, err
+		}
+		revoked = int(n)
+	}
+	return revoked, RDB.Del(ctx, userSessionsKey(userID)).Err()
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Stream output is buffered per owner and request ID so that a client
+// reconnecting to any replica can resume it. Frames are stored in order; a
+// frame's sequence number is its 1-based position in the list. Keys are
+// namespaced by owner, so a request ID picked by one user never collides
+// with, or reveals, another user's stream.
+
+func streamKey(owner, requestID string) string {
+	return "stream:" + owner + ":" + requestID
+}
+
+func streamClaimKey(owner, requestID string) string {
+	return streamKey(owner, requestID) + ":claim"
+}
+
+func streamAttachedKey(owner, requestID string) string {
+	return streamKey(owner, requestID) + ":attached"
+}
+
+// ClaimStream registers a new stream of owner. It returns false if the owner
+// already uses the request ID.
+func ClaimStream(ctx context.Context, owner, requestID string, ttl time.Duration) (bool, error) {
+	return RDB.SetNX(ctx, streamClaimKey(owner, requestID), 1, ttl).Result()
+}
+
+// StreamExists reports whether owner has a stream with the request ID that
+// has not expired yet.
+func StreamExists(ctx context.Context, owner, requestID string) (bool, error) {
+	n, err := RDB.Exists(ctx, streamClaimKey(owner, requestID)).Result()
+	return n > 0, err
+}
+
+// AppendStreamFrame appends a frame to the stream buffer and returns its sequence number.
+func AppendStreamFrame(ctx context.Context, owner, requestID string, frame []byte, ttl time.Duration) (int64, error) {
+	pipe := RDB.TxPipeline()
+	push := pipe.RPush(ctx, streamKey(owner, requestID), frame)
+	pipe.Expire(ctx, streamKey(owner, requestID), ttl)
+	pipe.Expire(ctx, streamClaimKey(owner, requestID), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return push.Val(), nil
+}
+
+// GetStreamFrames returns the frames with a sequence number greater than afterSeq.
+func GetStreamFrames(ctx context.Context, owner, requestID string, afterSeq int64) ([][]byte, error) {
+	vals, err := RDB.LRange(ctx, streamKey(owner, requestID), afterSeq, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	frames := make([][]byte, len(vals))
+	for i, v := range vals {
+		frames[i] = []byte(v)
+	}
+	return frames, nil
+}
+
+// MarkStreamAttached records that a client resumed the stream, so the
+// producer keeps running after its own client went away.
+func MarkStreamAttached(ctx context.Context, owner, requestID string, ttl time.Duration) error {
+	return RDB.Set(ctx, streamAttachedKey(owner, requestID), 1, ttl).Err()
+}
+
+// StreamAttached reports whether a client resumed the stream.
+func StreamAttached(ctx context.Context, owner, requestID string) (bool, error) {
+	n, err := RDB.Exists(ctx, streamAttachedKey(owner, requestID)).Result()
+	return n > 0, err
+}
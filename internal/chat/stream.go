@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"context"
+	"io"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/agent/v1"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+
+	"go.uber.org/zap"
+)
+
+// Sink receives the frames of a chat stream, e.g. a WebSocket client or an
+// SSE response.
+type Sink interface {
+	Send(msgType protocol.MessageType, payload any)
+}
+
+// Stream relays one chat request from the agent service to sink: a chat_start
+// frame, the content chunks and a chat_end frame with the finish reason and
+// usage, or an error frame if the stream fails. Callers without chat:use or
+// the permission for the requested model get a 403 error frame. It blocks
+// until the stream is done or ctx is cancelled.
+func Stream(ctx context.Context, agentClient agentv1.AgentServiceClient, requestID string, payload protocol.ChatPayload, perms model.Permissions, sink Sink) {
+	modelName := payload.Model
+	if modelName == "" {
+		modelName = protocol.DefaultModel
+	}
+	if !perms.Has(model.PermChatUse) || !perms.Has(model.ModelPermission(modelName)) {
+		sendError(sink, 403, "Model not allowed: "+modelName)
+		return
+	}
+
+	stream, err := agentClient.ChatStream(ctx, &agentv1.ChatRequest{
+		Model:     payload.Model,
+		Content:   payload.Content,
+		RequestId: requestID,
+	})
+	if err != nil {
+		sendError(sink, 500, err.Error())
+		return
+	}
+
+	sink.Send(protocol.TypeChatStart, protocol.ChatStartPayload{Model: payload.Model})
+
+	// The finish reason stays empty if the provider never reported one
+	var end protocol.ChatEndPayload
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Log.Error("Stream error", zap.String("request_id", requestID), zap.Error(err))
+			}
+			// Still sent when the client is gone so resumed streams terminate
+			sendError(sink, 500, "Stream interrupted")
+			return
+		}
+
+		// The final response carries the finish reason and usage only
+		if resp.FinishReason != "" {
+			end.FinishReason = resp.FinishReason
+		}
+		if resp.Usage != nil {
+			end.Usage = &protocol.Usage{
+				PromptTokens:     int(resp.Usage.PromptTokens),
+				CompletionTokens: int(resp.Usage.CompletionTokens),
+				TotalTokens:      int(resp.Usage.TotalTokens),
+			}
+		}
+		if resp.Content == "" {
+			continue
+		}
+
+		sink.Send(protocol.TypeChat, protocol.ChatPayload{
+			Content: resp.Content,
+			Type:    resp.Type,
+			Model:   payload.Model,
+		})
+	}
+
+	sink.Send(protocol.TypeChatEnd, end)
+}
+
+func sendError(sink Sink, code int, message string) {
+	sink.Send(protocol.TypeError, protocol.ErrorPayload{
+		Code:    code,
+		Message: message,
+	})
+}
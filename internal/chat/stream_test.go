@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/agent/v1"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// agentStream replays responses, then err.
+type agentStream struct {
+	grpc.ClientStream
+	responses []*agentv1.ChatResponse
+	err       error
+}
+
+func (s *agentStream) Recv() (*agentv1.ChatResponse, error) {
+	if len(s.responses) == 0 {
+		return nil, s.err
+	}
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	return resp, nil
+}
+
+type agentClient struct {
+	stream *agentStream
+}
+
+func (c agentClient) ChatStream(ctx context.Context, in *agentv1.ChatRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[agentv1.ChatResponse], error) {
+	return c.stream, nil
+}
+
+type frame struct {
+	msgType protocol.MessageType
+	payload any
+}
+
+type recorder []frame
+
+func (r *recorder) Send(msgType protocol.MessageType, payload any) {
+	*r = append(*r, frame{msgType, payload})
+}
+
+func TestStream(t *testing.T) {
+	cases := []struct {
+		name      string
+		stream    *agentStream
+		wantTypes []protocol.MessageType
+		wantEnd   protocol.ChatEndPayload
+	}{
+		{
+			name: "complete",
+			stream: &agentStream{err: io.EOF, responses: []*agentv1.ChatResponse{
+				{Content: "Hi", Type: "text"},
+				{FinishReason: "length", Usage: &agentv1.Usage{TotalTokens: 3}},
+			}},
+			wantTypes: []protocol.MessageType{protocol.TypeChatStart, protocol.TypeChat, protocol.TypeChatEnd},
+			wantEnd:   protocol.ChatEndPayload{FinishReason: "length", Usage: &protocol.Usage{TotalTokens: 3}},
+		},
+		{
+			name: "no finish reason",
+			stream: &agentStream{err: io.EOF, responses: []*agentv1.ChatResponse{
+				{Content: "Hi", Type: "text"},
+			}},
+			wantTypes: []protocol.MessageType{protocol.TypeChatStart, protocol.TypeChat, protocol.TypeChatEnd},
+		},
+		{
+			name: "interrupted",
+			stream: &agentStream{err: errors.New("upstream read failed"), responses: []*agentv1.ChatResponse{
+				{Content: "Hel", Type: "text"},
+			}},
+			wantTypes: []protocol.MessageType{protocol.TypeChatStart, protocol.TypeChat, protocol.TypeError},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sink recorder
+			perms := model.Permissions{model.PermChatUse, "model:*"}
+			Stream(context.Background(), agentClient{tc.stream}, "r1", protocol.ChatPayload{Content: "hi"}, perms, &sink)
+
+			if len(sink) != len(tc.wantTypes) {
+				t.Fatalf("got %d frames %+v, want %v", len(sink), sink, tc.wantTypes)
+			}
+			for i, f := range sink {
+				if f.msgType != tc.wantTypes[i] {
+					t.Fatalf("frame %d is %s, want %s", i, f.msgType, tc.wantTypes[i])
+				}
+			}
+			last := sink[len(sink)-1]
+			if last.msgType != protocol.TypeChatEnd {
+				return
+			}
+			end := last.payload.(protocol.ChatEndPayload)
+			if end.FinishReason != tc.wantEnd.FinishReason {
+				t.Fatalf("finish reason %q, want %q", end.FinishReason, tc.wantEnd.FinishReason)
+			}
+			if (end.Usage == nil) != (tc.wantEnd.Usage == nil) || end.Usage != nil && *end.Usage != *tc.wantEnd.Usage {
+				t.Fatalf("usage %+v, want %+v", end.Usage, tc.wantEnd.Usage)
+			}
+		})
+	}
+}
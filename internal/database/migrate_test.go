@@ -0,0 +1,102 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrationsEmbedded(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if i > 0 && m.Version <= migrations[i-1].Version {
+			t.Fatalf("migration %d listed after %d", m.Version, migrations[i-1].Version)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Fatalf("migration %d_%s has an empty script", m.Version, m.Name)
+		}
+	}
+}
+
+func file(sql string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(sql)}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_add_index.up.sql":    file("CREATE INDEX"),
+		"0010_add_index.down.sql":  file("DROP INDEX"),
+		"0002_create_foo.down.sql": file("DROP TABLE foo"),
+		"0002_create_foo.up.sql":   file("CREATE TABLE foo"),
+		"3_no_padding.up.sql":      file("UP 3"),
+		"3_no_padding.down.sql":    file("DOWN 3"),
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Migration{
+		{Version: 2, Name: "create_foo", Up: "CREATE TABLE foo", Down: "DROP TABLE foo"},
+		{Version: 3, Name: "no_padding", Up: "UP 3", Down: "DOWN 3"},
+		// Ordered by number, not by file name
+		{Version: 10, Name: "add_index", Up: "CREATE INDEX", Down: "DROP INDEX"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("got %d migrations, want %d", len(migrations), len(want))
+	}
+	for i := range want {
+		if migrations[i] != want[i] {
+			t.Errorf("migration %d: got %+v, want %+v", i, migrations[i], want[i])
+		}
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"missing down", fstest.MapFS{
+			"0001_init.up.sql": file("UP"),
+		}},
+		{"missing up", fstest.MapFS{
+			"0001_init.down.sql": file("DOWN"),
+		}},
+		{"names differ", fstest.MapFS{
+			"0001_init.up.sql":     file("UP"),
+			"0001_create.down.sql": file("DOWN"),
+		}},
+		{"no version", fstest.MapFS{
+			"init.up.sql":   file("UP"),
+			"init.down.sql": file("DOWN"),
+		}},
+		{"unknown direction", fstest.MapFS{
+			"0001_init.up.sql":   file("UP"),
+			"0001_init.down.sql": file("DOWN"),
+			"0001_init.redo.sql": file("REDO"),
+		}},
+		{"not sql", fstest.MapFS{
+			"0001_init.up.sql":   file("UP"),
+			"0001_init.down.sql": file("DOWN"),
+			"README.md":          file("notes"),
+		}},
+		{"dash in name", fstest.MapFS{
+			"0001_add-users.up.sql":   file("UP"),
+			"0001_add-users.down.sql": file("DOWN"),
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if migrations, err := loadMigrations(tc.fsys); err == nil {
+				t.Fatalf("accepted, got %+v", migrations)
+			}
+		})
+	}
+}
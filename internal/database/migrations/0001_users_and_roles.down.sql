@@ -0,0 +1,4 @@
+DROP TABLE users;
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE roles;
@@ -0,0 +1,41 @@
+CREATE TABLE roles (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    name       TEXT
+);
+CREATE UNIQUE INDEX idx_roles_name ON roles (name);
+CREATE INDEX idx_roles_deleted_at ON roles (deleted_at);
+
+CREATE TABLE permissions (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    name        TEXT,
+    description TEXT
+);
+CREATE UNIQUE INDEX idx_permissions_name ON permissions (name);
+CREATE INDEX idx_permissions_deleted_at ON permissions (deleted_at);
+
+CREATE TABLE role_permissions (
+    role_id       BIGINT REFERENCES roles (id),
+    permission_id BIGINT REFERENCES permissions (id),
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE users (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    username    TEXT,
+    password    TEXT,
+    email       TEXT,
+    role_id     BIGINT REFERENCES roles (id),
+    disabled_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_users_username ON users (username);
+CREATE INDEX idx_users_email ON users (email);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
@@ -0,0 +1,16 @@
+CREATE TABLE api_keys (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    deleted_at   TIMESTAMPTZ,
+    user_id      BIGINT REFERENCES users (id),
+    name         TEXT,
+    prefix       TEXT,
+    hash         TEXT,
+    scopes       TEXT, -- JSON array
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_api_keys_hash ON api_keys (hash);
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
+CREATE INDEX idx_api_keys_deleted_at ON api_keys (deleted_at);
@@ -0,0 +1,13 @@
+CREATE TABLE external_identities (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    provider   TEXT,
+    subject    TEXT,
+    user_id    BIGINT REFERENCES users (id),
+    email      TEXT
+);
+CREATE UNIQUE INDEX idx_external_identity ON external_identities (provider, subject);
+CREATE INDEX idx_external_identities_user_id ON external_identities (user_id);
+CREATE INDEX idx_external_identities_deleted_at ON external_identities (deleted_at);
@@ -0,0 +1,13 @@
+CREATE TABLE totps (
+    id             BIGSERIAL PRIMARY KEY,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ,
+    deleted_at     TIMESTAMPTZ,
+    user_id        BIGINT REFERENCES users (id),
+    secret         TEXT,
+    confirmed_at   TIMESTAMPTZ,
+    last_step      BIGINT NOT NULL DEFAULT 0,
+    recovery_codes TEXT -- JSON array of SHA-256 hashes
+);
+CREATE UNIQUE INDEX idx_totps_user_id ON totps (user_id);
+CREATE INDEX idx_totps_deleted_at ON totps (deleted_at);
@@ -0,0 +1,3 @@
+-- Fails if a username was registered again after its account was deleted
+DROP INDEX idx_users_username;
+CREATE UNIQUE INDEX idx_users_username ON users (username);
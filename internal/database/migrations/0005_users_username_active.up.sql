@@ -0,0 +1,3 @@
+-- Soft-deleted users keep their row, only live usernames have to be unique
+DROP INDEX idx_users_username;
+CREATE UNIQUE INDEX idx_users_username ON users (username) WHERE deleted_at IS NULL;
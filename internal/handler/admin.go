@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/yeliheng/go-ai-gateway/internal/websocket"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	wsManager *websocket.ClientManager
+}
+
+func NewAdminHandler(manager *websocket.ClientManager) *AdminHandler {
+	return &AdminHandler{
+		wsManager: manager,
+	}
+}
+
+// Broadcast pushes a system frame, e.g. a maintenance announcement, to connected sockets.
+func (h *AdminHandler) Broadcast(c *gin.Context) {
+	var input struct {
+		Target  string `json:"target"` // "all" (default), "user", "session" or "topic"
+		ID      string `json:"id"`
+		Event   string `json:"event"`
+		Message string `json:"message" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target := websocket.TargetKind(input.Target)
+	switch target {
+	case "":
+		target = websocket.TargetAll
+	case websocket.TargetAll:
+	case websocket.TargetUser, websocket.TargetSession, websocket.TargetTopic:
+		if input.ID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id is required for target " + input.Target})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown target"})
+		return
+	}
+
+	event := input.Event
+	if event == "" {
+		event = "announcement"
+	}
+	payload, _ := json.Marshal(protocol.SystemPayload{
+		Event:   event,
+		Message: input.Message,
+	})
+	msg := protocol.Message{
+		Type:    protocol.TypeSystem,
+		Payload: payload,
+	}
+
+	if err := h.wsManager.Dispatch(c.Request.Context(), websocket.Envelope{Target: target, ID: input.ID, Message: &msg}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Broadcast queued"})
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UserAdminHandler lets admins find and manage user accounts.
+type UserAdminHandler struct {
+	identityClient identityv1.IdentityServiceClient
+}
+
+func NewUserAdminHandler(client identityv1.IdentityServiceClient) *UserAdminHandler {
+	return &UserAdminHandler{
+		identityClient: client,
+	}
+}
+
+func userJSON(u *identityv1.User) gin.H {
+	return gin.H{
+		"id":          u.Id,
+		"username":    u.Username,
+		"email":       u.Email,
+		"role":        u.Role,
+		"disabled":    u.Disabled,
+		"mfa_enabled": u.MfaEnabled,
+		"created_at":  u.CreatedAt,
+		"deleted_at":  u.DeletedAt,
+	}
+}
+
+// List searches users: ?q=, ?role=, ?deleted=true, ?page= and ?page_size=.
+func (h *UserAdminHandler) List(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size"))
+
+	resp, err := h.identityClient.ListUsers(c.Request.Context(), &identityv1.ListUsersRequest{
+		Query:          c.Query("q"),
+		Role:           c.Query("role"),
+		IncludeDeleted: c.Query("deleted") == "true",
+		Page:           int32(page),
+		PageSize:       int32(pageSize),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	users := make([]gin.H, 0, len(resp.Users))
+	for _, u := range resp.Users {
+		users = append(users, userJSON(u))
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "total": resp.Total})
+}
+
+func (h *UserAdminHandler) SetRole(c *gin.Context) {
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.identityClient.SetUserRole(c.Request.Context(), &identityv1.SetUserRoleRequest{
+		ActorId: c.GetString("userID"),
+		UserId:  c.Param("id"),
+		Role:    input.Role,
+	})
+	if err != nil {
+		userAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userJSON(resp.User))
+}
+
+// Disable blocks a user's logins and revokes its sessions.
+func (h *UserAdminHandler) Disable(c *gin.Context) {
+	h.setDisabled(c, true)
+}
+
+func (h *UserAdminHandler) Enable(c *gin.Context) {
+	h.setDisabled(c, false)
+}
+
+func (h *UserAdminHandler) setDisabled(c *gin.Context, disabled bool) {
+	resp, err := h.identityClient.SetUserDisabled(c.Request.Context(), &identityv1.SetUserDisabledRequest{
+		ActorId:  c.GetString("userID"),
+		UserId:   c.Param("id"),
+		Disabled: disabled,
+	})
+	if err != nil {
+		userAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, userJSON(resp.User))
+}
+
+// Delete soft deletes a user, its row is kept with deleted_at set.
+func (h *UserAdminHandler) Delete(c *gin.Context) {
+	_, err := h.identityClient.DeleteUser(c.Request.Context(), &identityv1.DeleteUserRequest{
+		ActorId: c.GetString("userID"),
+		UserId:  c.Param("id"),
+	})
+	if err != nil {
+		userAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+func userAdminError(c *gin.Context, err error) {
+	switch status.Code(err) {
+	case codes.NotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case codes.InvalidArgument:
+		c.JSON(http.StatusBadRequest, gin.H{"error": status.Convert(err).Message()})
+	case codes.FailedPrecondition:
+		c.JSON(http.StatusConflict, gin.H{"error": status.Convert(err).Message()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyHandler manages the caller's API keys.
+type APIKeyHandler struct {
+	identityClient identityv1.IdentityServiceClient
+}
+
+func NewAPIKeyHandler(client identityv1.IdentityServiceClient) *APIKeyHandler {
+	return &APIKeyHandler{
+		identityClient: client,
+	}
+}
+
+func apiKeyJSON(k *identityv1.APIKey) gin.H {
+	return gin.H{
+		"id":           k.Id,
+		"name":         k.Name,
+		"prefix":       k.Prefix,
+		"scopes":       k.Scopes,
+		"created_at":   k.CreatedAt,
+		"expires_at":   k.ExpiresAt,
+		"last_used_at": k.LastUsedAt,
+	}
+}
+
+// Create issues a new key. The key is only ever shown in this response.
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var input struct {
+		Name      string   `json:"name" binding:"required"`
+		Scopes    []string `json:"scopes"`
+		ExpiresAt int64    `json:"expires_at"` // Unix time, 0 = never
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.identityClient.CreateAPIKey(c.Request.Context(), &identityv1.CreateAPIKeyRequest{
+		UserId:    c.GetString("userID"),
+		Name:      input.Name,
+		Scopes:    input.Scopes,
+		ExpiresAt: input.ExpiresAt,
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.InvalidArgument, codes.ResourceExhausted:
+			c.JSON(http.StatusBadRequest, gin.H{"error": status.Convert(err).Message()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		}
+		return
+	}
+
+	body := apiKeyJSON(resp.Key)
+	body["api_key"] = resp.ApiKey
+	c.JSON(http.StatusCreated, body)
+}
+
+func (h *APIKeyHandler) List(c *gin.Context) {
+	resp, err := h.identityClient.ListAPIKeys(c.Request.Context(), &identityv1.ListAPIKeysRequest{
+		UserId: c.GetString("userID"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	keys := make([]gin.H, 0, len(resp.Keys))
+	for _, k := range resp.Keys {
+		keys = append(keys, apiKeyJSON(k))
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	_, err := h.identityClient.RevokeAPIKey(c.Request.Context(), &identityv1.RevokeAPIKeyRequest{
+		UserId: c.GetString("userID"),
+		Id:     c.Param("id"),
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
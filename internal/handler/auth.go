@@ -6,6 +6,8 @@ import (
 	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type AuthHandler struct {
@@ -22,6 +24,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	var input struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
+		Email    string `json:"email"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -32,9 +35,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	resp, err := h.identityClient.Register(c.Request.Context(), &identityv1.RegisterRequest{
 		Username: input.Username,
 		Password: input.Password,
+		Email:    input.Email,
 	})
 
 	if err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			c.JSON(http.StatusBadRequest, gin.H{"error": status.Convert(err).Message()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -54,19 +62,108 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	resp, err := h.identityClient.Login(c.Request.Context(), &identityv1.LoginRequest{
-		Username: input.Username,
-		Password: input.Password,
+		Username:  input.Username,
+		Password:  input.Password,
+		Ip:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
 	})
 
 	if err != nil {
-		// Map gRPC errors to HTTP status if needed, simplified here
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		switch status.Code(err) {
+		case codes.Unauthenticated:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": status.Convert(err).Message()})
+		case codes.ResourceExhausted:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": status.Convert(err).Message()})
+		case codes.PermissionDenied:
+			c.JSON(http.StatusForbidden, gin.H{"error": status.Convert(err).Message()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		}
+		return
+	}
+
+	// The password was right, the client has to send a code to /login/mfa
+	if resp.MfaRequired {
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    resp.MfaToken,
+			"username":     resp.Username,
+		})
 		return
 	}
 
+	loginJSON(c, resp)
+}
+
+func loginJSON(c *gin.Context, resp *identityv1.LoginResponse) {
 	c.JSON(http.StatusOK, gin.H{
-		"token":    resp.Token,
-		"username": resp.Username,
-		"role":     resp.Role,
+		"token":              resp.Token,
+		"expires_at":         resp.ExpiresAt,
+		"refresh_token":      resp.RefreshToken,
+		"refresh_expires_at": resp.RefreshExpiresAt,
+		"username":           resp.Username,
+		"role":               resp.Role,
+	})
+}
+
+// Refresh swaps a refresh token for a new access/refresh token pair.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.identityClient.Refresh(c.Request.Context(), &identityv1.RefreshRequest{
+		RefreshToken: input.RefreshToken,
 	})
+
+	if err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": status.Convert(err).Message()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":              resp.Token,
+		"expires_at":         resp.ExpiresAt,
+		"refresh_token":      resp.RefreshToken,
+		"refresh_expires_at": resp.RefreshExpiresAt,
+	})
+}
+
+// Logout revokes the caller's token and the login session it belongs to.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	_, err := h.identityClient.Logout(c.Request.Context(), &identityv1.LogoutRequest{
+		Token: c.GetString("token"),
+	})
+	if err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Not a login session token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll revokes every login session of the caller, on all devices.
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	resp, err := h.identityClient.RevokeAllSessions(c.Request.Context(), &identityv1.RevokeAllSessionsRequest{
+		UserId: c.GetString("userID"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked", "revoked": resp.Revoked})
 }
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/agent/v1"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/internal/chat"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type ChatHandler struct {
+	agentClient agentv1.AgentServiceClient
+}
+
+func NewChatHandler(client agentv1.AgentServiceClient) *ChatHandler {
+	return &ChatHandler{
+		agentClient: client,
+	}
+}
+
+// Stream answers a chat request as Server-Sent Events. Each event is named
+// after the frame type and carries the same protocol.Message as the
+// WebSocket path.
+func (h *ChatHandler) Stream(c *gin.Context) {
+	var input protocol.ChatPayload
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Content == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content is required"})
+		return
+	}
+
+	requestID := c.GetHeader("X-Request-ID")
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Don't let nginx buffer the stream
+	c.Header("X-Request-ID", requestID)
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	perms, _ := c.Get("permissions")
+	granted, _ := perms.(model.Permissions)
+	chat.Stream(c.Request.Context(), h.agentClient, requestID, input, granted, &sseSink{c: c, requestID: requestID})
+}
+
+// sseSink writes stream frames to an SSE response.
+type sseSink struct {
+	c         *gin.Context
+	requestID string
+}
+
+func (s *sseSink) Send(msgType protocol.MessageType, payload any) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		logger.Log.Error("Failed to marshal payload", zap.Error(err))
+		return
+	}
+	s.c.SSEvent(string(msgType), protocol.Message{
+		Type:      msgType,
+		RequestID: s.requestID,
+		Payload:   b,
+	})
+	s.c.Writer.Flush()
+}
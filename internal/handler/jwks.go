@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/internal/jwtkeys"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const jwksRefreshInterval = 5 * time.Minute
+
+// JWKSHandler serves the public keys access tokens are signed with, so other
+// services can verify tokens without a shared secret.
+type JWKSHandler struct {
+	keys *jwtkeys.Remote
+}
+
+// NewJWKSHandler fetches the keys from the identity service and keeps them
+// up to date.
+func NewJWKSHandler(client identityv1.IdentityServiceClient) *JWKSHandler {
+	keys := jwtkeys.NewRemote(func(ctx context.Context) (jwtkeys.JWKS, error) {
+		resp, err := client.GetJWKS(ctx, &identityv1.GetJWKSRequest{})
+		if err != nil {
+			return jwtkeys.JWKS{}, err
+		}
+		set := jwtkeys.JWKS{Keys: make([]jwtkeys.JWK, 0, len(resp.Keys))}
+		for _, k := range resp.Keys {
+			set.Keys = append(set.Keys, jwtkeys.JWK{
+				Kty: k.Kty,
+				Kid: k.Kid,
+				Use: k.Use,
+				Alg: k.Alg,
+				N:   k.N,
+				E:   k.E,
+				Crv: k.Crv,
+				X:   k.X,
+				Y:   k.Y,
+			})
+		}
+		return set, nil
+	})
+
+	// The identity service may still be starting, the next refresh catches up
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := keys.Refresh(ctx); err != nil {
+		logger.Log.Error("Failed to fetch JWKS", zap.Error(err))
+	}
+	go keys.Run(context.Background(), jwksRefreshInterval)
+
+	return &JWKSHandler{keys: keys}
+}
+
+func (h *JWKSHandler) Serve(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MFAHandler finishes logins that need a second factor and manages the
+// caller's TOTP enrollment.
+type MFAHandler struct {
+	identityClient identityv1.IdentityServiceClient
+}
+
+func NewMFAHandler(client identityv1.IdentityServiceClient) *MFAHandler {
+	return &MFAHandler{
+		identityClient: client,
+	}
+}
+
+// Verify exchanges the MFA token from /login and a TOTP or recovery code for
+// the login tokens.
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.identityClient.VerifyMFA(c.Request.Context(), &identityv1.VerifyMFARequest{
+		MfaToken: input.MFAToken,
+		Code:     input.Code,
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unauthenticated:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": status.Convert(err).Message()})
+		case codes.ResourceExhausted:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": status.Convert(err).Message()})
+		case codes.PermissionDenied:
+			c.JSON(http.StatusForbidden, gin.H{"error": status.Convert(err).Message()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		}
+		return
+	}
+
+	loginJSON(c, resp)
+}
+
+// Enroll starts TOTP enrollment and returns the secret to add to an
+// authenticator app.
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	resp, err := h.identityClient.EnrollTOTP(c.Request.Context(), &identityv1.EnrollTOTPRequest{
+		UserId: c.GetString("userID"),
+	})
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": resp.Secret, "uri": resp.Uri})
+}
+
+// Confirm enables TOTP with a first code from the app. The recovery codes are
+// only shown in this response.
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	code, ok := h.bindCode(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.identityClient.ConfirmTOTP(c.Request.Context(), &identityv1.ConfirmTOTPRequest{
+		UserId: c.GetString("userID"),
+		Code:   code,
+	})
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": resp.RecoveryCodes})
+}
+
+func (h *MFAHandler) Disable(c *gin.Context) {
+	code, ok := h.bindCode(c)
+	if !ok {
+		return
+	}
+
+	_, err := h.identityClient.DisableTOTP(c.Request.Context(), &identityv1.DisableTOTPRequest{
+		UserId: c.GetString("userID"),
+		Code:   code,
+	})
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "TOTP disabled"})
+}
+
+func (h *MFAHandler) bindCode(c *gin.Context) (string, bool) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return input.Code, true
+}
+
+func mfaError(c *gin.Context, err error) {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		c.JSON(http.StatusBadRequest, gin.H{"error": status.Convert(err).Message()})
+	case codes.FailedPrecondition:
+		c.JSON(http.StatusConflict, gin.H{"error": status.Convert(err).Message()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+	}
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/internal/cache"
+	"github.com/yeliheng/go-ai-gateway/internal/oidc"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	oidcStateTTL    = 10 * time.Minute
+	oidcStateCookie = "oidc_state"
+)
+
+// OIDCHandler logs users in through an OpenID Connect provider and hands them
+// the gateway's own tokens.
+type OIDCHandler struct {
+	provider          *oidc.Provider
+	identityClient    identityv1.IdentityServiceClient
+	postLoginRedirect string
+}
+
+func NewOIDCHandler(provider *oidc.Provider, client identityv1.IdentityServiceClient, postLoginRedirect string) *OIDCHandler {
+	if postLoginRedirect == "" {
+		postLoginRedirect = "/login"
+	}
+	return &OIDCHandler{
+		provider:          provider,
+		identityClient:    client,
+		postLoginRedirect: postLoginRedirect,
+	}
+}
+
+// Login redirects the browser to the provider.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, ar, err := h.provider.NewAuthRequest(c.Request.Context())
+	if err != nil {
+		logger.Log.Error("OIDC login failed", zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	data, _ := json.Marshal(ar)
+	if err := cache.SaveOIDCState(c.Request.Context(), ar.State, data, oidcStateTTL); err != nil {
+		logger.Log.Error("Failed to save OIDC state", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	// Ties the callback to this browser, so a login can't be forced on someone else
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, ar.State, int(oidcStateTTL.Seconds()), "/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback finishes the login when the provider redirects back. The tokens
+// are passed to the post-login page in the URL fragment, which isn't sent to
+// servers or kept in logs.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed: " + e})
+		return
+	}
+
+	state := c.Query("state")
+	cookie, _ := c.Cookie(oidcStateCookie)
+	if state == "" || cookie != state {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", "", c.Request.TLS != nil, true)
+
+	data, err := cache.TakeOIDCState(c.Request.Context(), state)
+	if err != nil {
+		logger.Log.Error("Failed to load OIDC state", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+	var ar oidc.AuthRequest
+	if data == nil || json.Unmarshal(data, &ar) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login expired, please try again"})
+		return
+	}
+
+	claims, err := h.provider.Exchange(c.Request.Context(), c.Query("code"), &ar)
+	if err != nil {
+		logger.Log.Warn("OIDC code exchange failed", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed"})
+		return
+	}
+
+	// Don't trust addresses the provider hasn't verified
+	email := claims.Email
+	if !claims.EmailVerified {
+		email = ""
+	}
+	resp, err := h.identityClient.ExternalLogin(c.Request.Context(), &identityv1.ExternalLoginRequest{
+		Provider:          h.provider.Issuer(),
+		Subject:           claims.Subject,
+		Email:             email,
+		PreferredUsername: claims.PreferredUsername,
+		Ip:                c.ClientIP(),
+		UserAgent:         c.Request.UserAgent(),
+	})
+	if err != nil {
+		if status.Code(err) == codes.PermissionDenied {
+			c.JSON(http.StatusForbidden, gin.H{"error": status.Convert(err).Message()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	fragment := url.Values{
+		"token":              {resp.Token},
+		"expires_at":         {strconv.FormatInt(resp.ExpiresAt, 10)},
+		"refresh_token":      {resp.RefreshToken},
+		"refresh_expires_at": {strconv.FormatInt(resp.RefreshExpiresAt, 10)},
+	}
+	c.Redirect(http.StatusFound, h.postLoginRedirect+"#"+fragment.Encode())
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOIDCCallbackState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewOIDCHandler(nil, nil, "")
+	r := gin.New()
+	r.GET("/auth/oidc/callback", h.Callback)
+
+	cases := []struct {
+		name   string
+		query  string
+		cookie string
+		want   int
+	}{
+		{"provider error", "?error=access_denied&state=s1", "s1", http.StatusUnauthorized},
+		{"missing state", "?code=c", "s1", http.StatusBadRequest},
+		{"missing cookie", "?code=c&state=s1", "", http.StatusBadRequest},
+		{"state of another browser", "?code=c&state=s1", "s2", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback"+tc.query, nil)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tc.cookie})
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PasswordHandler changes and resets passwords.
+type PasswordHandler struct {
+	identityClient identityv1.IdentityServiceClient
+}
+
+func NewPasswordHandler(client identityv1.IdentityServiceClient) *PasswordHandler {
+	return &PasswordHandler{
+		identityClient: client,
+	}
+}
+
+// Change sets a new password for the caller. Other sessions are logged out,
+// the current one stays.
+func (h *PasswordHandler) Change(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.identityClient.ChangePassword(c.Request.Context(), &identityv1.ChangePasswordRequest{
+		UserId:          c.GetString("userID"),
+		CurrentPassword: input.CurrentPassword,
+		NewPassword:     input.NewPassword,
+		SessionId:       c.GetString("sid"),
+	})
+	if err != nil {
+		passwordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed", "revoked": resp.Revoked})
+}
+
+// RequestReset sends a reset link. It answers the same whether the account
+// exists or not.
+func (h *PasswordHandler) RequestReset(c *gin.Context) {
+	var input struct {
+		Login string `json:"login" binding:"required"` // Username or email
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.identityClient.RequestPasswordReset(c.Request.Context(), &identityv1.RequestPasswordResetRequest{
+		Login: input.Login,
+	}); err != nil {
+		passwordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the account exists, a reset link has been sent"})
+}
+
+// Reset sets a new password with the token from a reset link.
+func (h *PasswordHandler) Reset(c *gin.Context) {
+	var input struct {
+		Token       string `json:"token" binding:"required"`
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.identityClient.ResetPassword(c.Request.Context(), &identityv1.ResetPasswordRequest{
+		Token:       input.Token,
+		NewPassword: input.NewPassword,
+	}); err != nil {
+		passwordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset, please log in"})
+}
+
+func passwordError(c *gin.Context, err error) {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		c.JSON(http.StatusBadRequest, gin.H{"error": status.Convert(err).Message()})
+	case codes.Unauthenticated:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": status.Convert(err).Message()})
+	case codes.PermissionDenied:
+		c.JSON(http.StatusForbidden, gin.H{"error": status.Convert(err).Message()})
+	case codes.FailedPrecondition:
+		c.JSON(http.StatusConflict, gin.H{"error": status.Convert(err).Message()})
+	case codes.ResourceExhausted:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": status.Convert(err).Message()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+	}
+}
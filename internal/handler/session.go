@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SessionHandler lets users see where they are logged in and end sessions.
+type SessionHandler struct {
+	identityClient identityv1.IdentityServiceClient
+}
+
+func NewSessionHandler(client identityv1.IdentityServiceClient) *SessionHandler {
+	return &SessionHandler{
+		identityClient: client,
+	}
+}
+
+// List returns the caller's active sessions, marking the one of the current token.
+func (h *SessionHandler) List(c *gin.Context) {
+	resp, err := h.identityClient.ListSessions(c.Request.Context(), &identityv1.ListSessionsRequest{
+		UserId: c.GetString("userID"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	current := c.GetString("sid")
+	sessions := make([]gin.H, 0, len(resp.Sessions))
+	for _, s := range resp.Sessions {
+		sessions = append(sessions, gin.H{
+			"id":           s.Id,
+			"ip":           s.Ip,
+			"user_agent":   s.UserAgent,
+			"created_at":   s.CreatedAt,
+			"last_seen_at": s.LastSeenAt,
+			"current":      s.Id == current,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// Revoke ends one of the caller's sessions. Its tokens stop working and its
+// WebSocket connections are closed.
+func (h *SessionHandler) Revoke(c *gin.Context) {
+	_, err := h.identityClient.RevokeSession(c.Request.Context(), &identityv1.RevokeSessionRequest{
+		UserId:    c.GetString("userID"),
+		SessionId: c.Param("id"),
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
@@ -0,0 +1,174 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// JWK is a public key in JSON Web Key form (RFC 7517). RSA, EC (P-256,
+// P-384, P-521) and Ed25519 keys are supported.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// JWKS returns the public keys of the set.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(ks.order))}
+	for _, id := range ks.order {
+		k := ks.keys[id]
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+		switch pub := k.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = b64.EncodeToString(pub.N.Bytes())
+			jwk.E = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = b64.EncodeToString(pub)
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = b64.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = b64.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// FromJWKS builds a verify-only key set from public keys. Keys that can't
+// verify tokens, e.g. encryption keys or unsupported curves, are skipped; it
+// fails only if no key is left.
+func FromJWKS(set JWKS) (*KeySet, error) {
+	ks := newKeySet()
+	for _, jwk := range set.Keys {
+		// Providers may publish encryption keys in the same set
+		if jwk.Use == "enc" {
+			continue
+		}
+		key, err := jwk.verifyKey()
+		if err != nil {
+			logger.Log.Debug("Skipping JWK", zap.String("kid", jwk.Kid), zap.Error(err))
+			continue
+		}
+		ks.add(key)
+	}
+	if len(set.Keys) > 0 && len(ks.keys) == 0 {
+		return nil, errors.New("jwks has no supported signing key")
+	}
+	return ks, nil
+}
+
+// verifyKey returns the key with the algorithm it is published for, or the
+// default one of its type if the JWK doesn't name one.
+func (jwk JWK) verifyKey() (*Key, error) {
+	pub, err := jwk.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	alg := jwk.Alg
+	if alg == "" {
+		if alg, err = algorithmFor(pub); err != nil {
+			return nil, err
+		}
+	}
+
+	var ok bool
+	switch jwt.GetSigningMethod(alg).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = pub.(*rsa.PublicKey)
+	case *jwt.SigningMethodECDSA:
+		// The curve decides the algorithm
+		def, _ := algorithmFor(pub)
+		ok = def == alg
+	case *jwt.SigningMethodEd25519:
+		_, ok = pub.(ed25519.PublicKey)
+	}
+	if !ok || !slices.Contains(Algorithms, alg) {
+		return nil, fmt.Errorf("unsupported algorithm %q for %s key", alg, jwk.Kty)
+	}
+	return &Key{ID: jwk.Kid, Algorithm: alg, Public: pub}, nil
+}
+
+func (jwk JWK) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := b64.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := b64.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
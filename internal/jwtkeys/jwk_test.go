@@ -0,0 +1,120 @@
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+func rsaJWK(t *testing.T, kid, alg string) (*rsa.PrivateKey, JWK) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Alg: alg,
+		N:   b64.EncodeToString(priv.N.Bytes()),
+		E:   b64.EncodeToString(big.NewInt(int64(priv.E)).Bytes()),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Minute).Unix()})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestFromJWKSUsesPublishedAlgorithm(t *testing.T) {
+	priv, jwk := rsaJWK(t, "rs512", "RS512")
+	ks, err := FromJWKS(JWKS{Keys: []JWK{jwk}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ks.keys["rs512"].Algorithm; got != "RS512" {
+		t.Fatalf("algorithm = %s, want RS512", got)
+	}
+
+	if _, err := ks.Parse(sign(t, jwt.SigningMethodRS512, "rs512", priv)); err != nil {
+		t.Fatalf("RS512 token rejected: %v", err)
+	}
+	if _, err := ks.Parse(sign(t, jwt.SigningMethodRS256, "rs512", priv)); err == nil {
+		t.Fatal("RS256 token accepted for an RS512 key")
+	}
+}
+
+func TestFromJWKSSkipsUnsupportedKeys(t *testing.T) {
+	_, sig := rsaJWK(t, "sig", "")
+	_, enc := rsaJWK(t, "enc", "")
+	enc.Use = "enc"
+	_, oaep := rsaJWK(t, "oaep", "RSA-OAEP")
+	ecPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mismatched := JWK{
+		Kty: "EC", Kid: "p256-es384", Crv: "P-256", Alg: "ES384",
+		X: b64.EncodeToString(ecPriv.X.Bytes()), Y: b64.EncodeToString(ecPriv.Y.Bytes()),
+	}
+	secp256k1 := JWK{Kty: "EC", Kid: "k1", Crv: "secp256k1", X: "AA", Y: "AA"}
+	x448 := JWK{Kty: "OKP", Kid: "x448", Crv: "X448", X: "AA"}
+
+	ks, err := FromJWKS(JWKS{Keys: []JWK{enc, oaep, mismatched, secp256k1, x448, sig}})
+	if err != nil {
+		t.Fatalf("set with one usable key rejected: %v", err)
+	}
+	if len(ks.keys) != 1 || !ks.Has("sig") {
+		t.Fatalf("want only key sig, got %v", ks.order)
+	}
+	if ks.keys["sig"].Algorithm != "RS256" {
+		t.Fatalf("default RSA algorithm = %s, want RS256", ks.keys["sig"].Algorithm)
+	}
+
+	if _, err := FromJWKS(JWKS{Keys: []JWK{enc, secp256k1}}); err == nil {
+		t.Fatal("set without usable keys accepted")
+	}
+}
+
+func TestKeyfuncWithoutKid(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	one := JWK{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: b64.EncodeToString(pub)}
+	ks, err := FromJWKS(JWKS{Keys: []JWK{one}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(sign(t, jwt.SigningMethodEdDSA, "", priv)); err != nil {
+		t.Fatalf("token without kid rejected by a single key set: %v", err)
+	}
+
+	_, other := rsaJWK(t, "rsa", "")
+	ks, err = FromJWKS(JWKS{Keys: []JWK{one, other}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(sign(t, jwt.SigningMethodEdDSA, "", priv)); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("token without kid: want ErrUnknownKey with two keys, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithms accepted when verifying tokens.
+var Algorithms = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodRS384.Alg(),
+	jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodPS256.Alg(),
+	jwt.SigningMethodPS384.Alg(),
+	jwt.SigningMethodPS512.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodES512.Alg(),
+}
+
+var (
+	ErrNoKeys       = errors.New("no key configured, set jwt.keys or jwt.allowEphemeral")
+	ErrNoSigningKey = errors.New("no signing key")
+	ErrUnknownKey   = errors.New("unknown key id")
+)
+
+// Key is one JWT key. Private is nil for keys that only verify, e.g. keys
+// fetched from a JWKS or retired keys kept around until their tokens expire.
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// KeySet holds the keys tokens may be signed with. New tokens are signed with
+// the active key and carry its ID in the "kid" header.
+type KeySet struct {
+	keys   map[string]*Key
+	order  []string
+	active *Key
+}
+
+func newKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]*Key)}
+}
+
+func (ks *KeySet) add(k *Key) {
+	if _, ok := ks.keys[k.ID]; !ok {
+		ks.order = append(ks.order, k.ID)
+	}
+	ks.keys[k.ID] = k
+}
+
+// Load reads the keys configured under jwt.keys. The active key is
+// jwt.signingKey, or the first key with a private key. Without any configured
+// key Load fails, unless jwt.allowEphemeral is set: an ephemeral Ed25519 key
+// is generated then, whose tokens don't survive a restart (ephemeral reports
+// it).
+func Load(cfg config.JWTConfig) (ks *KeySet, ephemeral bool, err error) {
+	ks = newKeySet()
+	for _, kc := range cfg.Keys {
+		k, err := loadKey(kc)
+		if err != nil {
+			return nil, false, fmt.Errorf("jwt key %q: %w", kc.ID, err)
+		}
+		ks.add(k)
+	}
+
+	if len(ks.keys) == 0 {
+		if !cfg.AllowEphemeral {
+			return nil, false, ErrNoKeys
+		}
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, false, err
+		}
+		ks.add(&Key{ID: "ephemeral", Algorithm: jwt.SigningMethodEdDSA.Alg(), Private: priv, Public: priv.Public()})
+		ephemeral = true
+	}
+
+	if cfg.SigningKey != "" {
+		ks.active = ks.keys[cfg.SigningKey]
+		if ks.active == nil || ks.active.Private == nil {
+			return nil, false, fmt.Errorf("signing key %q not configured with a private key", cfg.SigningKey)
+		}
+	} else {
+		for _, id := range ks.order {
+			if k := ks.keys[id]; k.Private != nil {
+				ks.active = k
+				break
+			}
+		}
+	}
+	if ks.active == nil {
+		return nil, false, ErrNoSigningKey
+	}
+	return ks, ephemeral, nil
+}
+
+func loadKey(kc config.JWTKeyConfig) (*Key, error) {
+	if kc.ID == "" {
+		return nil, errors.New("id is required")
+	}
+
+	var pub crypto.PublicKey
+	var priv crypto.Signer
+	switch {
+	case kc.PrivateKeyFile != "":
+		block, err := readPEM(kc.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			// openssl genrsa writes PKCS#1, openssl ecparam SEC 1
+			if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+				if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+					return nil, errors.New("unsupported private key format")
+				}
+			}
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+		priv, pub = signer, signer.Public()
+	case kc.PublicKeyFile != "":
+		block, err := readPEM(kc.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if pub, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("privateKeyFile or publicKeyFile is required")
+	}
+
+	alg, err := algorithmFor(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: kc.ID, Algorithm: alg, Private: priv, Public: pub}, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
+
+// algorithmFor returns the JWT algorithm used with a public key.
+func algorithmFor(pub crypto.PublicKey) (string, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256.Alg(), nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA.Alg(), nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256.Alg(), nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384.Alg(), nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512.Alg(), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported key type %T", pub)
+}
+
+// Sign signs claims with the active key.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.active == nil {
+		return "", ErrNoSigningKey
+	}
+	token := jwt.NewWithClaims(ks.active.method(), claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.Private)
+}
+
+// Keyfunc returns the public key a token was signed with, for jwt.Parse.
+// Tokens without a key ID are accepted if the set has a single key.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(ks.order) == 1 {
+		kid = ks.order[0]
+	}
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != k.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return k.Public, nil
+}
+
+// Has reports whether the set contains a key.
+func (ks *KeySet) Has(kid string) bool {
+	_, ok := ks.keys[kid]
+	return ok
+}
+
+// Parse verifies a token against the set and returns its claims.
+func (ks *KeySet) Parse(tokenString string, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	opts = append(opts, jwt.WithValidMethods(Algorithms))
+	token, err := jwt.Parse(tokenString, ks.Keyfunc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	return claims, nil
+}
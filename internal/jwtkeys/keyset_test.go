@@ -0,0 +1,48 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+)
+
+func TestLoadRequiresKey(t *testing.T) {
+	if _, _, err := Load(config.JWTConfig{}); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("Load without keys: want ErrNoKeys, got %v", err)
+	}
+
+	ks, ephemeral, err := Load(config.JWTConfig{AllowEphemeral: true})
+	if err != nil || !ephemeral || ks.active == nil {
+		t.Fatalf("Load with allowEphemeral: ephemeral=%v err=%v", ephemeral, err)
+	}
+}
+
+func TestLoadConfiguredKey(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, ephemeral, err := Load(config.JWTConfig{
+		AllowEphemeral: true,
+		Keys:           []config.JWTKeyConfig{{ID: "k1", PrivateKeyFile: path}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ephemeral || ks.active.ID != "k1" {
+		t.Fatalf("want active key k1, got %s (ephemeral=%v)", ks.active.ID, ephemeral)
+	}
+}
@@ -0,0 +1,100 @@
+package jwtkeys
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// Unknown key IDs trigger a refetch at most this often, so tokens signed with
+// a freshly rotated key verify without waiting for the next refresh.
+const minRefetchInterval = 30 * time.Second
+
+// Remote is a verify-only key set kept in sync with a JWKS source.
+type Remote struct {
+	fetch func(ctx context.Context) (JWKS, error)
+
+	mu        sync.RWMutex
+	jwks      JWKS
+	keys      *KeySet
+	fetchedAt time.Time
+
+	// Serializes fetches
+	fetchMu sync.Mutex
+}
+
+func NewRemote(fetch func(ctx context.Context) (JWKS, error)) *Remote {
+	return &Remote{
+		fetch: fetch,
+		keys:  newKeySet(),
+	}
+}
+
+// Refresh fetches the current keys.
+func (r *Remote) Refresh(ctx context.Context) error {
+	r.fetchMu.Lock()
+	defer r.fetchMu.Unlock()
+
+	set, err := r.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := FromJWKS(set)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.jwks, r.keys, r.fetchedAt = set, keys, time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the keys every interval until ctx is done.
+func (r *Remote) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.Refresh(ctx); err != nil {
+			logger.Log.Error("Failed to refresh JWKS", zap.Error(err))
+		}
+	}
+}
+
+// JWKS returns the last fetched key set.
+func (r *Remote) JWKS() JWKS {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.jwks
+}
+
+// Parse verifies a token against the fetched keys and returns its claims.
+func (r *Remote) Parse(ctx context.Context, tokenString string, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	r.mu.RLock()
+	keys, fetchedAt := r.keys, r.fetchedAt
+	r.mu.RUnlock()
+
+	claims, err := keys.Parse(tokenString, opts...)
+	if errors.Is(err, ErrUnknownKey) && time.Since(fetchedAt) > minRefetchInterval {
+		if err := r.Refresh(ctx); err != nil {
+			logger.Log.Error("Failed to refresh JWKS", zap.Error(err))
+			return nil, ErrUnknownKey
+		}
+		r.mu.RLock()
+		keys = r.keys
+		r.mu.RUnlock()
+		claims, err = keys.Parse(tokenString, opts...)
+	}
+	return claims, err
+}
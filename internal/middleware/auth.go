@@ -1,50 +1,152 @@
 package middleware
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/yeliheng/go-ai-gateway/common/config"
-	"github.com/yeliheng/go-ai-gateway/internal/cache"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
 )
 
+// TokenSubprotocol marks the Sec-WebSocket-Protocol entry that follows it as
+// the access token, e.g. new WebSocket(url, ["access_token", token]).
+const TokenSubprotocol = "access_token"
+
+// ErrInvalidToken is returned for malformed, expired and revoked tokens.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Identity is the authenticated caller.
+type Identity struct {
+	UserID      string
+	Username    string
+	Role        string
+	SessionID   string // Login session (sid claim)
+	Permissions model.Permissions
+}
+
+// WebSocketAuthMiddleware authenticates the WebSocket handshake. The token is
+// taken from the Sec-WebSocket-Protocol header or, for compatibility, the
+// "token" query parameter. Without a token the upgrade goes ahead and the
+// client must authenticate with an auth frame instead ("authPending" is set).
 func WebSocketAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := c.Query("token")
+		tokenString := subprotocolToken(c.Request)
+		if tokenString == "" && !config.GlobalConfig.WebSocket.DisableQueryToken {
+			tokenString = c.Query("token")
+		}
 		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+			c.Set("authPending", true)
+			c.Next()
 			return
 		}
+		authenticate(c, tokenString)
+	}
+}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(config.GlobalConfig.JWT.Secret), nil
-		})
+// AuthMiddleware authenticates HTTP requests with an "Authorization: Bearer <token>" header.
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticate(c, bearerToken(c.Request))
+	}
+}
 
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			return
+// RequirePermission only lets callers holding all of the given permissions
+// through. It must run after an auth middleware.
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, _ := c.Get("permissions")
+		granted, _ := v.(model.Permissions)
+		for _, p := range perms {
+			if !granted.Has(p) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+				return
+			}
 		}
+		c.Next()
+	}
+}
 
-		valid, err := cache.ValidateToken(c.Request.Context(), tokenString)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal auth error"})
+// RejectAPIKey only lets login sessions through: an API key can't manage
+// the account it belongs to, e.g. mint more keys or change the password. It
+// must run after AuthMiddleware.
+func RejectAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.GetString("token"), model.APIKeyPrefix) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API keys can't manage the account"})
 			return
 		}
-		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token expired or revoked"})
-			return
+		c.Next()
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+func subprotocolToken(r *http.Request) string {
+	protocols := websocketSubprotocols(r)
+	for i, p := range protocols {
+		if p == TokenSubprotocol && i+1 < len(protocols) {
+			return protocols[i+1]
 		}
+	}
+	return ""
+}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			SetUserID(c, claims)
+func websocketSubprotocols(r *http.Request) []string {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(header, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				protocols = append(protocols, p)
+			}
 		}
+	}
+	return protocols
+}
 
-		c.Next()
+// ValidateToken checks a token with the identity service: its signature, and
+// that its session hasn't been revoked.
+func ValidateToken(ctx context.Context, tokenString string) (*Identity, error) {
+	if tokenValidator == nil {
+		return nil, errAuthNotInitialized
+	}
+	return tokenValidator.validate(ctx, tokenString)
+}
+
+func authenticate(c *gin.Context, tokenString string) {
+	if tokenString == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
 	}
+
+	identity, err := ValidateToken(c.Request.Context(), tokenString)
+	switch {
+	case errors.Is(err, ErrInvalidToken):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid, expired or revoked token"})
+		return
+	case err != nil:
+		logger.Log.Error("Token validation failed", zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal auth error"})
+		return
+	}
+
+	c.Set("userID", identity.UserID)
+	c.Set("username", identity.Username)
+	c.Set("role", identity.Role)
+	c.Set("permissions", identity.Permissions)
+	c.Set("sid", identity.SessionID)
+	c.Set("token", tokenString)
+
+	c.Next()
 }
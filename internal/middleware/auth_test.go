@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRejectAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		token string
+		want  int
+	}{
+		{"sk-abc123", http.StatusForbidden},
+		{"eyJhbGciOiJFZERTQSJ9.e30.sig", http.StatusOK},
+	}
+	for _, tc := range cases {
+		r := gin.New()
+		r.GET("/", func(c *gin.Context) { c.Set("token", tc.token) }, RejectAPIKey(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != tc.want {
+			t.Errorf("token %q: status %d, want %d", tc.token, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Query parameters carrying credentials, masked in access logs: WebSocket
+// tokens passed as ?token= and OIDC authorization codes.
+var redactedParams = map[string]bool{
+	"token":        true,
+	"access_token": true,
+	"code":         true,
+}
+
+// AccessLogger is gin's request logger with credentials in the query string
+// masked.
+func AccessLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+		p.Path = redactQuery(p.Path)
+		return formatAccessLog(p)
+	})
+}
+
+// redactQuery replaces the values of redactedParams in a request path,
+// leaving the rest of it as it was sent.
+func redactQuery(path string) string {
+	base, query, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if redactedParams[strings.ToLower(key)] {
+			params[i] = key + "=REDACTED"
+		}
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
+// formatAccessLog is the format of gin's default logger.
+func formatAccessLog(p gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if p.IsOutputColor() {
+		statusColor = p.StatusCodeColor()
+		methodColor = p.MethodColor()
+		resetColor = p.ResetColor()
+	}
+	if p.Latency > time.Minute {
+		p.Latency = p.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		p.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, p.StatusCode, resetColor,
+		p.Latency,
+		p.ClientIP,
+		methodColor, p.Method, resetColor,
+		p.Path,
+		p.ErrorMessage,
+	)
+}
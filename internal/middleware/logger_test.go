@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedactQuery(t *testing.T) {
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"/ws", "/ws"},
+		{"/ws?", "/ws?"},
+		{"/ws?token=eyJhbGciOi.x.y", "/ws?token=REDACTED"},
+		{"/ws?v=2&token=secret&x=1", "/ws?v=2&token=REDACTED&x=1"},
+		{"/ws?Token=secret", "/ws?Token=REDACTED"},
+		{"/ws?token", "/ws?token=REDACTED"},
+		{"/ws?token=a&token=b", "/ws?token=REDACTED&token=REDACTED"},
+		{"/ws?tokens=kept&my_token=kept", "/ws?tokens=kept&my_token=kept"},
+		{"/auth/oidc/callback?code=abc&state=xyz", "/auth/oidc/callback?code=REDACTED&state=xyz"},
+		{"/cb?access_token=abc", "/cb?access_token=REDACTED"},
+	}
+	for _, tc := range cases {
+		if got := redactQuery(tc.path); got != tc.want {
+			t.Errorf("redactQuery(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestAccessLoggerMasksToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	defaultWriter := gin.DefaultWriter
+	gin.DefaultWriter = &buf
+	defer func() { gin.DefaultWriter = defaultWriter }()
+
+	var seen string
+	r := gin.New()
+	r.Use(AccessLogger())
+	r.GET("/ws", func(c *gin.Context) { seen = c.Query("token") })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ws?token=secret-jwt", nil))
+
+	if seen != "secret-jwt" {
+		t.Fatalf("handler got token %q", seen)
+	}
+	if strings.Contains(buf.String(), "secret-jwt") || !strings.Contains(buf.String(), "/ws?token=REDACTED") {
+		t.Fatalf("unexpected log line %q", buf.String())
+	}
+}
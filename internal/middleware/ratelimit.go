@@ -1,13 +1,11 @@
 package middleware
 
 import (
-	"fmt"
 	"github.com/yeliheng/go-ai-gateway/common/logger"
 	"github.com/yeliheng/go-ai-gateway/internal/limiter"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 )
 
@@ -49,9 +47,3 @@ func RateLimitMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
-
-func SetUserID(c *gin.Context, claims jwt.MapClaims) {
-	if sub, ok := claims["sub"]; ok {
-		c.Set("userID", fmt.Sprint(sub))
-	}
-}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultValidationCacheTTL = 10 * time.Second
+	maxCachedTokens           = 10000
+)
+
+var tokenValidator *validator
+
+var errAuthNotInitialized = errors.New("token validation not initialized")
+
+// validator checks tokens with the identity service. Valid results are
+// cached for a short time so busy clients don't cost an RPC per request;
+// revocations announced over Redis evict them right away.
+type validator struct {
+	client identityv1.IdentityServiceClient
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedIdentity
+}
+
+type cachedIdentity struct {
+	identity *Identity
+	expires  time.Time
+}
+
+// InitAuth sets up token validation through the identity service. It must be
+// called before any auth middleware runs.
+func InitAuth(client identityv1.IdentityServiceClient) {
+	ttl := defaultValidationCacheTTL
+	if s := config.GlobalConfig.Auth.ValidationCacheTTL; s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			logger.Log.Warn("Invalid auth.validationCacheTTL, using default", zap.String("value", s))
+		} else {
+			ttl = d
+		}
+	}
+
+	tokenValidator = &validator{
+		client:  client,
+		ttl:     ttl,
+		entries: make(map[string]cachedIdentity),
+	}
+}
+
+func (v *validator) validate(ctx context.Context, token string) (*Identity, error) {
+	if v.ttl > 0 {
+		v.mu.Lock()
+		entry, ok := v.entries[token]
+		v.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.identity, nil
+		}
+	}
+
+	resp, err := v.client.ValidateToken(ctx, &identityv1.ValidateTokenRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	identity := &Identity{
+		UserID:      resp.UserId,
+		Username:    resp.Username,
+		Role:        resp.Role,
+		SessionID:   resp.SessionId,
+		Permissions: resp.Permissions,
+	}
+	if v.ttl > 0 {
+		v.store(token, identity)
+	}
+	return identity, nil
+}
+
+func (v *validator) store(token string, identity *Identity) {
+	now := time.Now()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.entries) >= maxCachedTokens {
+		for t, entry := range v.entries {
+			if now.After(entry.expires) {
+				delete(v.entries, t)
+			}
+		}
+		if len(v.entries) >= maxCachedTokens {
+			v.entries = make(map[string]cachedIdentity)
+		}
+	}
+	v.entries[token] = cachedIdentity{identity: identity, expires: now.Add(v.ttl)}
+}
+
+// ForgetRevoked evicts cached identities of a revoked session, or of every
+// session of the user when sessionID is empty.
+func ForgetRevoked(userID, sessionID string) {
+	v := tokenValidator
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for token, entry := range v.entries {
+		if sessionID != "" && entry.identity.SessionID == sessionID ||
+			sessionID == "" && entry.identity.UserID == userID {
+			delete(v.entries, token)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Package notify delivers messages to users, e.g. password reset links.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+
+	"go.uber.org/zap"
+)
+
+var ErrNoAddress = errors.New("user has no email address")
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the notifier called name: "log" (the default) or "smtp".
+func New(name string, smtpCfg config.SMTPConfig) (Notifier, error) {
+	switch name {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "smtp":
+		if smtpCfg.Addr == "" || smtpCfg.From == "" {
+			return nil, errors.New("smtp notifier needs addr and from")
+		}
+		if _, err := mail.ParseAddress(smtpCfg.From); err != nil {
+			return nil, fmt.Errorf("smtp from: %w", err)
+		}
+		return &SMTPNotifier{cfg: smtpCfg}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier %q", name)
+}
+
+// LogNotifier writes messages to the log instead of delivering them. Only for
+// development, the log then contains reset links.
+type LogNotifier struct{}
+
+func (LogNotifier) Send(ctx context.Context, msg Message) error {
+	logger.Log.Info("Notification", zap.String("to", msg.To), zap.String("subject", msg.Subject), zap.String("body", msg.Body))
+	return nil
+}
+
+// SMTPNotifier mails messages through an SMTP relay, with STARTTLS if the
+// server offers it.
+type SMTPNotifier struct {
+	cfg config.SMTPConfig
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	if msg.To == "" {
+		return ErrNoAddress
+	}
+	from, _ := mail.ParseAddress(n.cfg.From)
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		host, _, _ := net.SplitHostPort(n.cfg.Addr)
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	// net/smtp has no context support, run it in the background so the RPC
+	// isn't held up by a slow relay
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(n.cfg.Addr, auth, from.Address, []string{to.Address}, []byte(b.String()))
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,238 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/internal/jwtkeys"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const jwksRefreshInterval = time.Hour
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// discovery is the part of the provider metadata we use
+// (/.well-known/openid-configuration).
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the ID token claims used to identify and provision users.
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// Provider runs the authorization code flow with PKCE against an OpenID
+// Connect provider. Metadata is discovered on first use, so the gateway can
+// start while the provider is unreachable.
+type Provider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	mu   sync.Mutex
+	meta *discovery
+	keys *jwtkeys.Remote
+}
+
+func NewProvider(cfg config.OIDCConfig) *Provider {
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Issuer identifies the provider external identities are linked to.
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+func (p *Provider) discover(ctx context.Context) (*discovery, *jwtkeys.Remote, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, p.keys, nil
+	}
+
+	var meta discovery
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &meta); err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", meta.Issuer, p.cfg.Issuer)
+	}
+
+	keys := jwtkeys.NewRemote(func(ctx context.Context) (jwtkeys.JWKS, error) {
+		var set jwtkeys.JWKS
+		err := p.getJSON(ctx, meta.JWKSURI, &set)
+		return set, err
+	})
+	if err := keys.Refresh(ctx); err != nil {
+		return nil, nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	go keys.Run(context.Background(), jwksRefreshInterval)
+
+	p.meta, p.keys = &meta, keys
+	return p.meta, p.keys, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// AuthRequest is the state of one login attempt, kept by the caller until the
+// provider redirects back.
+type AuthRequest struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// NewAuthRequest returns the URL to send the browser to, and the state needed
+// to finish the login.
+func (p *Provider) NewAuthRequest(ctx context.Context) (string, *AuthRequest, error) {
+	meta, _, err := p.discover(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	ar := &AuthRequest{State: randomString(), Nonce: randomString(), CodeVerifier: randomString()}
+	challenge := sha256.Sum256([]byte(ar.CodeVerifier))
+
+	scopes := []string{"openid"}
+	for _, s := range p.cfg.Scopes {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {ar.State},
+		"nonce":                 {ar.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), ar, nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of
+// the ID token.
+func (p *Provider) Exchange(ctx context.Context, code string, ar *AuthRequest) (*Claims, error) {
+	meta, keys, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {ar.CodeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("oidc token exchange: %s: %s", resp.Status, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, ErrInvalidIDToken
+	}
+
+	return p.verify(ctx, keys, tokens.IDToken, ar.Nonce)
+}
+
+func (p *Provider) verify(ctx context.Context, keys *jwtkeys.Remote, idToken, nonce string) (*Claims, error) {
+	claims, err := keys.Parse(ctx, idToken,
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	}
+
+	c := &Claims{}
+	c.Subject, _ = claims["sub"].(string)
+	c.Email, _ = claims["email"].(string)
+	c.EmailVerified, _ = claims["email_verified"].(bool)
+	c.Name, _ = claims["name"].(string)
+	c.PreferredUsername, _ = claims["preferred_username"].(string)
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	return c, nil
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,232 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/internal/jwtkeys"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	testClientID     = "gateway"
+	testClientSecret = "secret"
+	testCode         = "auth-code"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// issuer is a minimal OpenID provider serving discovery, JWKS and the token
+// endpoint. The token endpoint enforces PKCE against the challenge of the
+// last authorization request.
+type issuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	nonce     string
+	// claims adjusts the ID token claims issued next
+	claims  func(jwt.MapClaims)
+	omitKid bool
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &issuer{key: key}
+
+	mux := http.NewServeMux()
+	discover := func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discovery{
+			Issuer:                iss.URL,
+			AuthorizationEndpoint: iss.URL + "/authorize",
+			TokenEndpoint:         iss.URL + "/token",
+			JWKSURI:               iss.URL + "/jwks",
+		})
+	}
+	mux.HandleFunc("GET /.well-known/openid-configuration", discover)
+	// Metadata claiming another issuer than the one it is served for
+	mux.HandleFunc("GET /realms/other/.well-known/openid-configuration", discover)
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding
+		json.NewEncoder(w).Encode(jwtkeys.JWKS{Keys: []jwtkeys.JWK{
+			// Providers often publish encryption keys next to signing keys
+			{Kty: "RSA", Kid: "enc", Use: "enc", Alg: "RSA-OAEP", N: b64.EncodeToString(key.N.Bytes()), E: "AQAB"},
+			{Kty: "RSA", Kid: "sig", Use: "sig", Alg: "RS256", N: b64.EncodeToString(key.N.Bytes()),
+				E: b64.EncodeToString(big.NewInt(int64(key.E)).Bytes())},
+		}})
+	})
+	mux.HandleFunc("POST /token", iss.token)
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+func (iss *issuer) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if id != testClientID || secret != testClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if r.PostFormValue("code") != testCode || base64.RawURLEncoding.EncodeToString(sum[:]) != iss.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            iss.URL,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"nonce":          iss.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+	}
+	if iss.claims != nil {
+		iss.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if !iss.omitKid {
+		token.Header["kid"] = "sig"
+	}
+	idToken, _ := token.SignedString(iss.key)
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+// authorize starts a login and records what the provider would see from the
+// browser redirect.
+func (iss *issuer) authorize(t *testing.T, p *Provider) *AuthRequest {
+	t.Helper()
+	authURL, ar, err := p.NewAuthRequest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("state") != ar.State || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	iss.mu.Lock()
+	iss.challenge, iss.nonce = q.Get("code_challenge"), q.Get("nonce")
+	iss.mu.Unlock()
+	return ar
+}
+
+func TestExchange(t *testing.T) {
+	iss := newIssuer(t)
+
+	cases := []struct {
+		name    string
+		claims  func(jwt.MapClaims)
+		request func(ar *AuthRequest)
+		noKid   bool
+		wantErr bool
+	}{
+		{name: "valid"},
+		// The encryption key is skipped, leaving a single signing key
+		{name: "no kid", noKid: true},
+		{name: "nonce mismatch", claims: func(c jwt.MapClaims) { c["nonce"] = "replayed" }, wantErr: true},
+		{name: "missing nonce", claims: func(c jwt.MapClaims) { delete(c, "nonce") }, wantErr: true},
+		{name: "wrong audience", claims: func(c jwt.MapClaims) { c["aud"] = "another-client" }, wantErr: true},
+		{name: "foreign azp", claims: func(c jwt.MapClaims) { c["azp"] = "another-client" }, wantErr: true},
+		{name: "wrong issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, wantErr: true},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-5 * time.Minute).Unix() }, wantErr: true},
+		{name: "missing exp", claims: func(c jwt.MapClaims) { delete(c, "exp") }, wantErr: true},
+		{name: "missing sub", claims: func(c jwt.MapClaims) { delete(c, "sub") }, wantErr: true},
+		{name: "wrong code verifier", request: func(ar *AuthRequest) { ar.CodeVerifier = "guessed" }, wantErr: true},
+		{name: "nonce of another login", request: func(ar *AuthRequest) { ar.Nonce = "other" }, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewProvider(config.OIDCConfig{
+				Issuer:       iss.URL,
+				ClientID:     testClientID,
+				ClientSecret: testClientSecret,
+				RedirectURL:  "http://gateway.test/auth/oidc/callback",
+			})
+			ar := iss.authorize(t, p)
+			if tc.request != nil {
+				tc.request(ar)
+			}
+			iss.mu.Lock()
+			iss.claims, iss.omitKid = tc.claims, tc.noKid
+			iss.mu.Unlock()
+
+			claims, err := p.Exchange(context.Background(), testCode, ar)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("exchange succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "user-1" || claims.Email != "user@example.com" || !claims.EmailVerified {
+				t.Fatalf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsForeignSignature(t *testing.T) {
+	iss := newIssuer(t)
+	p := NewProvider(config.OIDCConfig{Issuer: iss.URL, ClientID: testClientID})
+	_, keys, err := p.discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": iss.URL, "aud": testClientID, "sub": "user-1", "nonce": "n",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = "sig"
+	idToken, _ := token.SignedString(other)
+
+	if _, err := p.verify(context.Background(), keys, idToken, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("want ErrInvalidIDToken, got %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	iss := newIssuer(t)
+	p := NewProvider(config.OIDCConfig{Issuer: iss.URL + "/realms/other", ClientID: testClientID})
+	if _, _, err := p.NewAuthRequest(context.Background()); err == nil {
+		t.Fatal("discovery accepted metadata of another issuer")
+	}
+}
@@ -0,0 +1,117 @@
+// Package password checks new passwords against the configured policy.
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+)
+
+const (
+	defaultMinLength = 8
+	// bcrypt only looks at the first 72 bytes
+	maxLength = 72
+)
+
+// PolicyError explains why a password was refused; the message can be shown
+// to the user.
+type PolicyError struct {
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Reason
+}
+
+// Policy validates passwords. Breached passwords are kept as SHA-1 hashes so
+// both plain lists and Have I Been Pwned style hash lists can be used.
+type Policy struct {
+	minLength int
+	breached  map[[sha1.Size]byte]struct{}
+}
+
+// LoadPolicy builds the policy from config, reading the breached password
+// list if one is configured.
+func LoadPolicy(cfg config.PasswordConfig) (*Policy, error) {
+	p := &Policy{minLength: cfg.MinLength}
+	if p.minLength <= 0 {
+		p.minLength = defaultMinLength
+	}
+	if p.minLength > maxLength {
+		return nil, fmt.Errorf("minLength must be at most %d", maxLength)
+	}
+
+	if cfg.BreachedListFile != "" {
+		breached, err := loadBreached(cfg.BreachedListFile)
+		if err != nil {
+			return nil, fmt.Errorf("breached password list: %w", err)
+		}
+		p.breached = breached
+	}
+	return p, nil
+}
+
+// loadBreached reads one password per line. Lines of 40 hex digits, optionally
+// followed by ":count", are taken as SHA-1 hashes.
+func loadBreached(path string) (map[[sha1.Size]byte]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	set := make(map[[sha1.Size]byte]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		var sum [sha1.Size]byte
+		if len(hash) == 2*sha1.Size {
+			if _, err := hex.Decode(sum[:], []byte(hash)); err == nil {
+				set[sum] = struct{}{}
+				continue
+			}
+		}
+		set[sha1.Sum([]byte(line))] = struct{}{}
+	}
+	return set, scanner.Err()
+}
+
+// Validate returns a *PolicyError if password can't be used by username.
+func (p *Policy) Validate(password, username string) error {
+	if strings.TrimSpace(password) == "" {
+		return &PolicyError{"password must not be blank"}
+	}
+	if !utf8.ValidString(password) {
+		return &PolicyError{"password must be valid UTF-8"}
+	}
+	if utf8.RuneCountInString(password) < p.minLength {
+		return &PolicyError{fmt.Sprintf("password must be at least %d characters", p.minLength)}
+	}
+	if len(password) > maxLength {
+		return &PolicyError{fmt.Sprintf("password must be at most %d bytes", maxLength)}
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		return &PolicyError{"password must not be the username"}
+	}
+	if _, ok := p.breached[sha1.Sum([]byte(password))]; ok {
+		return &PolicyError{"password appears in a list of breached passwords"}
+	}
+	return nil
+}
+
+// IsPolicyError reports whether err is a policy violation.
+func IsPolicyError(err error) bool {
+	var pe *PolicyError
+	return errors.As(err, &pe)
+}
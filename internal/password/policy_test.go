@@ -0,0 +1,104 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+)
+
+func hashLine(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestValidate(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	lines := []string{
+		"letmein123",                                  // plain
+		hashLine("correcthorse") + ":42",              // HIBP, with count
+		strings.ToLower(hashLine("trustno1trustno1")), // bare hash, lower case
+		"",
+		"windows-line\r",
+	}
+	if err := os.WriteFile(list, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPolicy(config.PasswordConfig{MinLength: 10, BreachedListFile: list})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		password string
+		username string
+		ok       bool
+	}{
+		{name: "valid", password: "a long passphrase", username: "alice", ok: true},
+		{name: "blank", password: "           ", ok: false},
+		{name: "empty", password: "", ok: false},
+		{name: "too short", password: "short", ok: false},
+		{name: "exactly min length", password: "0123456789", ok: true},
+		// Length is counted in characters, not bytes
+		{name: "multibyte at min length", password: "éééééééééé", ok: true},
+		{name: "multibyte below min length", password: "ééééééééé", ok: false},
+		{name: "at max bytes", password: strings.Repeat("a", maxLength), ok: true},
+		{name: "over max bytes", password: strings.Repeat("a", maxLength+1), ok: false},
+		{name: "over max bytes in multibyte", password: strings.Repeat("é", maxLength/2+1), ok: false},
+		{name: "invalid UTF-8", password: "password\xff\xfe12", ok: false},
+		{name: "equals username", password: "alice-in-wonderland", username: "alice-in-wonderland", ok: false},
+		{name: "equals username ignoring case", password: "Alice-In-Wonderland", username: "alice-in-wonderland", ok: false},
+		{name: "contains username", password: "alice-in-wonderland", username: "alice", ok: true},
+		{name: "breached plain", password: "letmein123", ok: false},
+		{name: "breached HIBP hash", password: "correcthorse", ok: false},
+		{name: "breached lower case hash", password: "trustno1trustno1", ok: false},
+		{name: "breached with CRLF", password: "windows-line", ok: false},
+		{name: "breached list is case sensitive", password: "LETMEIN123", ok: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := p.Validate(tc.password, tc.username)
+			if tc.ok {
+				if err != nil {
+					t.Fatalf("rejected: %v", err)
+				}
+				return
+			}
+			if !IsPolicyError(err) {
+				t.Fatalf("want a policy error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := LoadPolicy(config.PasswordConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.minLength != defaultMinLength {
+		t.Fatalf("min length %d, want the default %d", p.minLength, defaultMinLength)
+	}
+
+	if _, err := LoadPolicy(config.PasswordConfig{MinLength: maxLength + 1}); err == nil {
+		t.Fatal("accepted a min length bcrypt can't hold")
+	}
+	if _, err := LoadPolicy(config.PasswordConfig{BreachedListFile: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Fatal("accepted a missing breached list")
+	}
+}
+
+func TestIsPolicyError(t *testing.T) {
+	if IsPolicyError(errors.New("disk full")) || IsPolicyError(nil) {
+		t.Fatal("other errors taken for policy errors")
+	}
+	if !IsPolicyError(&PolicyError{"too short"}) {
+		t.Fatal("policy error not recognised")
+	}
+}
@@ -8,6 +8,16 @@ type Chunk struct {
 	Content string
 	Type    string // "text" or "reasoning"
 	Error   error  // Optional error
+
+	// Set on the last chunk of a stream
+	FinishReason string
+	Usage        *Usage
+}
+
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
 }
 
 type AIProvider interface {
@@ -49,6 +49,21 @@ func (p *MockProvider) Stream(ctx context.Context, input string) (<-chan Chunk,
 				time.Sleep(time.Duration(rand.Intn(50)+30) * time.Millisecond)
 			}
 		}
+
+		// Rough usage estimate: one token per rune
+		promptTokens := len([]rune(input))
+		completionTokens := len([]rune(reasoning)) + len([]rune(response))
+		select {
+		case <-ctx.Done():
+		case outputChan <- Chunk{
+			FinishReason: "stop",
+			Usage: &Usage{
+				PromptTokens:     promptTokens,
+				CompletionTokens: completionTokens,
+				TotalTokens:      promptTokens + completionTokens,
+			},
+		}:
+		}
 	}()
 
 	return outputChan, nil
@@ -42,7 +42,8 @@ func (o *OpenAIProvider) Stream(ctx context.Context, input string) (<-chan Chunk
 			{Role: "system", Content: o.cfg.SystemPrompt},
 			{Role: "user", Content: input},
 		},
-		Stream: true,
+		Stream:        true,
+		StreamOptions: &StreamOptions{IncludeUsage: true},
 	}
 
 	jsonBytes, err := json.Marshal(reqBody)
@@ -77,6 +78,19 @@ func (o *OpenAIProvider) Stream(ctx context.Context, input string) (<-chan Chunk
 
 		reader := bufio.NewReader(resp.Body)
 
+		// Emitted once the stream is done
+		var finishReason string
+		var usage *Usage
+		defer func() {
+			if finishReason == "" && usage == nil {
+				return
+			}
+			select {
+			case outputChan <- Chunk{FinishReason: finishReason, Usage: usage}:
+			case <-ctx.Done():
+			}
+		}()
+
 		for {
 			select {
 			case <-ctx.Done():
@@ -88,6 +102,12 @@ func (o *OpenAIProvider) Stream(ctx context.Context, input string) (<-chan Chunk
 			if err != nil {
 				if err != io.EOF {
 					logger.Log.Error("Stream read error", zap.Error(err))
+					// The answer is cut off, it must not end like a complete one
+					finishReason, usage = "", nil
+					select {
+					case outputChan <- Chunk{Error: fmt.Errorf("stream read failed: %w", err)}:
+					case <-ctx.Done():
+					}
 				}
 				return
 			}
@@ -113,7 +133,19 @@ func (o *OpenAIProvider) Stream(ctx context.Context, input string) (<-chan Chunk
 				continue
 			}
 
+			if streamResp.Usage != nil {
+				usage = &Usage{
+					PromptTokens:     streamResp.Usage.PromptTokens,
+					CompletionTokens: streamResp.Usage.CompletionTokens,
+					TotalTokens:      streamResp.Usage.TotalTokens,
+				}
+			}
+
 			if len(streamResp.Choices) > 0 {
+				if streamResp.Choices[0].FinishReason != "" {
+					finishReason = streamResp.Choices[0].FinishReason
+				}
+
 				delta := streamResp.Choices[0].Delta
 
 				// Thinking
@@ -141,9 +173,14 @@ func (o *OpenAIProvider) Stream(ctx context.Context, input string) (<-chan Chunk
 }
 
 type ChatCompletionRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
+	Model         string         `json:"model"`
+	Messages      []Message      `json:"messages"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type Message struct {
@@ -157,5 +194,11 @@ type StreamResponse struct {
 			Content          string `json:"content"`
 			ReasoningContent string `json:"reasoning_content"` // Support reasoning
 		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
 }
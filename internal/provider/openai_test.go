@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+func newTestProvider(t *testing.T, handler http.HandlerFunc) *OpenAIProvider {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return &OpenAIProvider{client: srv.Client(), cfg: config.OpenAIConfig{BaseURL: srv.URL}}
+}
+
+func collect(t *testing.T, p *OpenAIProvider) []Chunk {
+	t.Helper()
+	ch, err := p.Stream(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks []Chunk
+	for c := range ch {
+		chunks = append(chunks, c)
+	}
+	return chunks
+}
+
+func TestStreamComplete(t *testing.T) {
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"length\"}]}\n\n" +
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":1,\"completion_tokens\":2,\"total_tokens\":3}}\n\n" +
+			"data: [DONE]\n\n"))
+	})
+
+	chunks := collect(t, p)
+	if len(chunks) != 2 || chunks[0].Content != "Hi" {
+		t.Fatalf("unexpected chunks %+v", chunks)
+	}
+	last := chunks[1]
+	if last.Error != nil || last.FinishReason != "length" || last.Usage == nil || last.Usage.TotalTokens != 3 {
+		t.Fatalf("unexpected final chunk %+v", last)
+	}
+}
+
+func TestStreamReadError(t *testing.T) {
+	p := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"},\"finish_reason\":\"\"}]}\n\n"))
+		w.(http.Flusher).Flush()
+		// Drop the connection in the middle of the chunked body
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	})
+
+	chunks := collect(t, p)
+	if len(chunks) != 2 || chunks[0].Content != "Hel" {
+		t.Fatalf("unexpected chunks %+v", chunks)
+	}
+	last := chunks[1]
+	if last.Error == nil {
+		t.Fatalf("truncated stream ended without an error: %+v", last)
+	}
+	if last.FinishReason != "" {
+		t.Fatalf("truncated stream reported finish reason %q", last.FinishReason)
+	}
+}
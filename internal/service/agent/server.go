@@ -6,6 +6,7 @@ import (
 	"github.com/yeliheng/go-ai-gateway/api/gen/agent/v1"
 	"github.com/yeliheng/go-ai-gateway/common/logger"
 	"github.com/yeliheng/go-ai-gateway/internal/provider"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
 
 	"go.uber.org/zap"
 )
@@ -22,10 +23,10 @@ func NewAgentServer(providers map[string]provider.AIProvider) *Server {
 }
 
 func (s *Server) ChatStream(req *agentv1.ChatRequest, stream agentv1.AgentService_ChatStreamServer) error {
-	logger.Log.Info("ChatStream request received", zap.String("model", req.Model))
+	logger.Log.Info("ChatStream request received", zap.String("model", req.Model), zap.String("request_id", req.RequestId))
 	pName := req.Model
 	if pName == "" {
-		pName = "mock"
+		pName = protocol.DefaultModel
 	}
 
 	p, ok := s.providers[pName]
@@ -47,8 +48,16 @@ func (s *Server) ChatStream(req *agentv1.ChatRequest, stream agentv1.AgentServic
 		}
 
 		resp := &agentv1.ChatResponse{
-			Content: chunk.Content,
-			Type:    chunk.Type,
+			Content:      chunk.Content,
+			Type:         chunk.Type,
+			FinishReason: chunk.FinishReason,
+		}
+		if chunk.Usage != nil {
+			resp.Usage = &agentv1.Usage{
+				PromptTokens:     int32(chunk.Usage.PromptTokens),
+				CompletionTokens: int32(chunk.Usage.CompletionTokens),
+				TotalTokens:      int32(chunk.Usage.TotalTokens),
+			}
 		}
 
 		if err := stream.Send(resp); err != nil {
@@ -57,6 +66,6 @@ func (s *Server) ChatStream(req *agentv1.ChatRequest, stream agentv1.AgentServic
 		}
 	}
 
-	logger.Log.Info("ChatStream completed successfully")
+	logger.Log.Info("ChatStream completed successfully", zap.String("request_id", req.RequestId))
 	return nil
 }
@@ -1,15 +1,21 @@
 package biz
 
 import (
+	"context"
+	"expvar"
 	"fmt"
+	"net/http"
 
 	"github.com/yeliheng/go-ai-gateway/api/gen/agent/v1"
 	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
 	"github.com/yeliheng/go-ai-gateway/common/config"
 	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/common/shutdown"
 	"github.com/yeliheng/go-ai-gateway/internal/cache"
 	"github.com/yeliheng/go-ai-gateway/internal/handler"
 	"github.com/yeliheng/go-ai-gateway/internal/middleware"
+	"github.com/yeliheng/go-ai-gateway/internal/oidc"
 	"github.com/yeliheng/go-ai-gateway/internal/websocket"
 	"github.com/yeliheng/go-ai-gateway/pkg/telemetry"
 
@@ -21,7 +27,15 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-func NewServer() *gin.Engine {
+type Server struct {
+	Engine    *gin.Engine
+	WsManager *websocket.ClientManager
+
+	// Flushes pending traces, nil if tracing failed to start
+	shutdownTracer func(context.Context) error
+}
+
+func NewServer() *Server {
 	cache.InitRedis()
 
 	// Init Tracing
@@ -32,9 +46,7 @@ func NewServer() *gin.Engine {
 	shutdown, err := telemetry.InitTracer("gateway", jaegerAddr)
 	if err != nil {
 		logger.Log.Error("Failed to init tracer", zap.Error(err))
-	} else {
-		// Handle shutdown gracefully
-		_ = shutdown
+		shutdown = nil
 	}
 
 	// Connect to Identity Service
@@ -67,42 +79,134 @@ func NewServer() *gin.Engine {
 	}
 	agentClient := agentv1.NewAgentServiceClient(agentConn)
 
-	r := gin.Default()
+	// gin.Default, minus credentials in the logged query strings
+	r := gin.New()
+	r.Use(middleware.AccessLogger(), gin.Recovery())
 	r.Use(otelgin.Middleware("gateway"))
 
 	// Handler Injection
 	authHandler := handler.NewAuthHandler(identityClient)
+	jwksHandler := handler.NewJWKSHandler(identityClient)
+	middleware.InitAuth(identityClient)
 
 	// Auth Routes
 	r.Use(middleware.RateLimitMiddleware()) // Global Rate Limit
 	r.POST("/register", authHandler.Register)
 	r.POST("/login", authHandler.Login)
+	r.POST("/refresh", authHandler.Refresh)
+
+	// Account management, login sessions only
+	account := r.Group("", middleware.AuthMiddleware(), middleware.RejectAPIKey())
+
+	passwordHandler := handler.NewPasswordHandler(identityClient)
+	account.POST("/password/change", passwordHandler.Change)
+	r.POST("/password/reset/request", passwordHandler.RequestReset)
+	r.POST("/password/reset", passwordHandler.Reset)
+
+	mfaHandler := handler.NewMFAHandler(identityClient)
+	r.POST("/login/mfa", mfaHandler.Verify)
+	mfa := account.Group("/mfa/totp")
+	mfa.POST("/enroll", mfaHandler.Enroll)
+	mfa.POST("/confirm", mfaHandler.Confirm)
+	mfa.POST("/disable", mfaHandler.Disable)
+	r.GET("/.well-known/jwks.json", jwksHandler.Serve)
+	r.POST("/logout", middleware.AuthMiddleware(), authHandler.Logout)
+	account.POST("/logout/all", authHandler.LogoutAll)
+
+	// Single sign-on
+	oidcCfg := config.GlobalConfig.OIDC
+	if oidcCfg.Enabled {
+		oidcHandler := handler.NewOIDCHandler(oidc.NewProvider(oidcCfg), identityClient, oidcCfg.PostLoginRedirect)
+		r.GET("/auth/oidc/login", oidcHandler.Login)
+		r.GET("/auth/oidc/callback", oidcHandler.Callback)
+	}
+
+	sessionHandler := handler.NewSessionHandler(identityClient)
+	sessions := account.Group("/sessions")
+	sessions.GET("", sessionHandler.List)
+	sessions.DELETE("/:id", sessionHandler.Revoke)
+
+	apiKeyHandler := handler.NewAPIKeyHandler(identityClient)
+	apiKeys := account.Group("/api-keys")
+	apiKeys.POST("", apiKeyHandler.Create)
+	apiKeys.GET("", apiKeyHandler.List)
+	apiKeys.DELETE("/:id", apiKeyHandler.Revoke)
 
 	// WebSocket Manager
 	wsManager := websocket.NewClientManager()
 	go wsManager.Run()
 
+	// Admin Routes
+	adminHandler := handler.NewAdminHandler(wsManager)
+	admin := r.Group("/admin", middleware.AuthMiddleware())
+	admin.POST("/broadcast", middleware.RequirePermission(model.PermAdminBroadcast), adminHandler.Broadcast)
+	admin.GET("/debug/vars", middleware.RequirePermission(model.PermAdminMetrics), gin.WrapH(expvar.Handler())) // WebSocket backpressure metrics
+
+	userAdminHandler := handler.NewUserAdminHandler(identityClient)
+	users := admin.Group("/users", middleware.RequirePermission(model.PermAdminUsers))
+	users.GET("", userAdminHandler.List)
+	users.PUT("/:id/role", userAdminHandler.SetRole)
+	users.POST("/:id/disable", userAdminHandler.Disable)
+	users.POST("/:id/enable", userAdminHandler.Enable)
+	users.DELETE("/:id", userAdminHandler.Delete)
+
 	// Routes
 	r.GET("/chat", middleware.WebSocketAuthMiddleware(), func(c *gin.Context) {
 		websocket.ServeWs(wsManager, agentClient, c)
 	})
+	chatHandler := handler.NewChatHandler(agentClient)
+	r.POST("/chat/stream", middleware.AuthMiddleware(), middleware.RequirePermission(model.PermChatUse), chatHandler.Stream) // SSE for clients without WebSocket
 
 	r.LoadHTMLFiles("web/index.html", "web/login.html")
 	r.GET("/", func(c *gin.Context) {
 		c.HTML(200, "index.html", nil)
 	})
 	r.GET("/login", func(c *gin.Context) {
-		c.HTML(200, "login.html", nil)
+		c.HTML(200, "login.html", gin.H{"oidcEnabled": oidcCfg.Enabled})
 	})
 
-	return r
+	return &Server{
+		Engine:         r,
+		WsManager:      wsManager,
+		shutdownTracer: shutdown,
+	}
 }
 
+// Run serves until SIGINT/SIGTERM, then drains WebSocket streams and shuts down.
 func Run() error {
-	r := NewServer()
+	s := NewServer()
 	port := config.GlobalConfig.Services.Biz.Port
 	if port == "" {
 		logger.Log.Fatal("Biz service port is required but missing")
 	}
-	return r.Run(fmt.Sprintf(":%s", port))
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%s", port),
+		Handler: s.Engine,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case sig := <-shutdown.Notify():
+		logger.Log.Info("Shutting down biz", zap.String("signal", sig.String()))
+	}
+
+	ctx, cancel := shutdown.Context()
+	defer cancel()
+
+	// Stop taking new sockets first, WebSockets are hijacked so srv.Shutdown doesn't wait for them
+	s.WsManager.Shutdown(ctx)
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Log.Error("HTTP server shutdown failed", zap.Error(err))
+	}
+
+	shutdown.FlushTraces(ctx, s.shutdownTracer)
+	logger.Log.Info("Biz stopped")
+	return nil
 }
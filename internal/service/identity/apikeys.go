@@ -0,0 +1,200 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/internal/cache"
+	"github.com/yeliheng/go-ai-gateway/internal/database"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	// Length of the key shown in listings, "sk-" included
+	apiKeyDisplayLength = 11
+
+	maxAPIKeysPerUser = 50
+	// last_used_at is only written when older than this
+	apiKeyTouchInterval = time.Minute
+)
+
+// apiKeySessionID is the session ID reported for requests made with a key, so
+// revoking the key closes its connections like a revoked login session.
+func apiKeySessionID(id uint) string {
+	return "apikey:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func apiKeyInfo(key *model.APIKey) *identityv1.APIKey {
+	info := &identityv1.APIKey{
+		Id:        fmt.Sprint(key.ID),
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt.Unix(),
+	}
+	if key.ExpiresAt != nil {
+		info.ExpiresAt = key.ExpiresAt.Unix()
+	}
+	if key.LastUsedAt != nil {
+		info.LastUsedAt = key.LastUsedAt.Unix()
+	}
+	return info
+}
+
+func (s *Server) CreateAPIKey(ctx context.Context, req *identityv1.CreateAPIKeyRequest) (*identityv1.CreateAPIKeyResponse, error) {
+	userID, err := strconv.ParseUint(req.UserId, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 64 {
+		return nil, status.Error(codes.InvalidArgument, "name must be 1-64 characters")
+	}
+	for _, scope := range req.Scopes {
+		if scope == "" {
+			return nil, status.Error(codes.InvalidArgument, "empty scope")
+		}
+	}
+
+	var count int64
+	if err := database.DB.Model(&model.APIKey{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count >= maxAPIKeysPerUser {
+		return nil, status.Error(codes.ResourceExhausted, "too many API keys")
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	apiKey := model.APIKeyPrefix + secret
+
+	key := model.APIKey{
+		UserID: uint(userID),
+		Name:   name,
+		Prefix: apiKey[:apiKeyDisplayLength],
+		Hash:   hashAPIKey(apiKey),
+		Scopes: req.Scopes,
+	}
+	if req.ExpiresAt != 0 {
+		expiresAt := time.Unix(req.ExpiresAt, 0)
+		if expiresAt.Before(time.Now()) {
+			return nil, status.Error(codes.InvalidArgument, "expires_at is in the past")
+		}
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(&key).Error; err != nil {
+		logger.Log.Error("Failed to create API key", zap.Error(err))
+		return nil, err
+	}
+
+	logger.Log.Info("API key created", zap.Uint64("user_id", userID), zap.Uint("key_id", key.ID))
+	return &identityv1.CreateAPIKeyResponse{
+		ApiKey: apiKey,
+		Key:    apiKeyInfo(&key),
+	}, nil
+}
+
+func (s *Server) ListAPIKeys(ctx context.Context, req *identityv1.ListAPIKeysRequest) (*identityv1.ListAPIKeysResponse, error) {
+	userID, err := strconv.ParseUint(req.UserId, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	var keys []model.APIKey
+	if err := database.DB.Where("user_id = ?", userID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	resp := &identityv1.ListAPIKeysResponse{}
+	for i := range keys {
+		resp.Keys = append(resp.Keys, apiKeyInfo(&keys[i]))
+	}
+	return resp, nil
+}
+
+func (s *Server) RevokeAPIKey(ctx context.Context, req *identityv1.RevokeAPIKeyRequest) (*identityv1.RevokeAPIKeyResponse, error) {
+	userID, err := strconv.ParseUint(req.UserId, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	// IDs that aren't numbers can't name a key
+	id, err := strconv.ParseUint(req.Id, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "API key not found")
+	}
+	res := database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&model.APIKey{})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, status.Error(codes.NotFound, "API key not found")
+	}
+
+	if err := cache.PublishRevocation(ctx, cache.Revocation{UserID: req.UserId, SessionID: apiKeySessionID(uint(id))}); err != nil {
+		logger.Log.Error("Failed to publish revocation", zap.Error(err))
+	}
+	return &identityv1.RevokeAPIKeyResponse{}, nil
+}
+
+// validateAPIKey resolves an API key to its user. The permissions are those
+// of the user's role, narrowed to the key's scopes.
+func (s *Server) validateAPIKey(ctx context.Context, apiKey string) (*identityv1.ValidateTokenResponse, error) {
+	var key model.APIKey
+	err := database.DB.WithContext(ctx).Preload("User.Role").Where("hash = ?", hashAPIKey(apiKey)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &identityv1.ValidateTokenResponse{Valid: false}, nil
+	}
+	if err != nil {
+		logger.Log.Error("API key validation failed: db error", zap.Error(err))
+		return nil, err
+	}
+
+	now := time.Now()
+	// User is empty if it has been deleted
+	if key.User.ID == 0 || key.User.DisabledAt != nil || key.ExpiresAt != nil && key.ExpiresAt.Before(now) {
+		return &identityv1.ValidateTokenResponse{Valid: false}, nil
+	}
+
+	permissions, err := rolePermissions(key.User.Role.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(key.Scopes) > 0 {
+		permissions = model.Permissions(permissions).Intersect(key.Scopes)
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := database.DB.Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			logger.Log.Warn("Failed to record API key use", zap.Error(err))
+		}
+	}
+
+	return &identityv1.ValidateTokenResponse{
+		Valid:       true,
+		UserId:      fmt.Sprint(key.UserID),
+		Username:    key.User.Username,
+		Role:        key.User.Role.Name,
+		SessionId:   apiKeySessionID(key.ID),
+		Permissions: permissions,
+	}, nil
+}
@@ -0,0 +1,117 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/internal/database"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const maxUsernameLength = 32
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// ExternalLogin logs in the user linked to an external identity. Users are
+// created on their first login, with the role configured under
+// oidc.defaultRole and no password.
+func (s *Server) ExternalLogin(ctx context.Context, req *identityv1.ExternalLoginRequest) (*identityv1.LoginResponse, error) {
+	if req.Provider == "" || req.Subject == "" {
+		return nil, status.Error(codes.InvalidArgument, "provider and subject are required")
+	}
+
+	var ext model.ExternalIdentity
+	err := database.DB.WithContext(ctx).Preload("User.Role").
+		Where("provider = ? AND subject = ?", req.Provider, req.Subject).First(&ext).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if ext, err = provisionExternalUser(ctx, req); err != nil {
+			logger.Log.Error("Failed to provision external user", zap.String("provider", req.Provider), zap.Error(err))
+			return nil, err
+		}
+	case err != nil:
+		logger.Log.Error("External login failed: db error", zap.Error(err))
+		return nil, err
+	case ext.User.ID == 0, ext.User.DisabledAt != nil:
+		// The linked user has been deleted or disabled
+		return nil, errAccountDisabled
+	}
+
+	// The provider is trusted with the second factor, TOTP only guards passwords
+	return s.login(ctx, &ext.User, req.Ip, req.UserAgent)
+}
+
+func provisionExternalUser(ctx context.Context, req *identityv1.ExternalLoginRequest) (model.ExternalIdentity, error) {
+	roleName := config.GlobalConfig.OIDC.DefaultRole
+	if roleName == "" {
+		roleName = DefaultRole
+	}
+
+	ext := model.ExternalIdentity{Provider: req.Provider, Subject: req.Subject, Email: req.Email}
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var role model.Role
+		if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+			return fmt.Errorf("role %q: %w", roleName, err)
+		}
+
+		username, err := availableUsername(tx, usernameCandidate(req))
+		if err != nil {
+			return err
+		}
+		// The empty password never matches a bcrypt hash, so the user can
+		// only log in through the provider
+		ext.User = model.User{Username: username, Email: req.Email, RoleID: role.ID, Role: role}
+		return tx.Create(&ext).Error
+	})
+	if err != nil {
+		return ext, err
+	}
+
+	logger.Log.Info("External user provisioned", zap.String("provider", req.Provider), zap.Uint("user_id", ext.User.ID))
+	return ext, nil
+}
+
+// usernameCandidate picks a username from the provider's claims.
+func usernameCandidate(req *identityv1.ExternalLoginRequest) string {
+	name := req.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(req.Email, "@")
+	}
+	name = usernameInvalidChars.ReplaceAllString(name, "")
+	if name == "" {
+		name = "oidc-" + usernameInvalidChars.ReplaceAllString(req.Subject, "")
+	}
+	if len(name) > maxUsernameLength {
+		name = name[:maxUsernameLength]
+	}
+	return name
+}
+
+// availableUsername returns name, or name with a numeric suffix if it is
+// already taken. Names of deleted users are free.
+func availableUsername(tx *gorm.DB, name string) (string, error) {
+	candidate := name
+	for i := 2; i < 100; i++ {
+		var count int64
+		if err := tx.Model(&model.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		suffix := fmt.Sprintf("-%d", i)
+		candidate = name[:min(len(name), maxUsernameLength-len(suffix))] + suffix
+	}
+	return "", errors.New("no free username for " + name)
+}
@@ -0,0 +1,125 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/internal/cache"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultFreeAttempts    = 3
+	defaultMaxAttempts     = 10
+	defaultLoginDelay      = time.Second
+	defaultFailureWindow   = 15 * time.Minute
+	defaultLockoutDuration = 15 * time.Minute
+
+	maxLoginDelay = 5 * time.Minute
+)
+
+var errInvalidCredentials = status.Error(codes.Unauthenticated, "invalid credentials")
+
+// dummyPasswordHash is compared against for unknown users, so they take as
+// long to reject as a wrong password.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte(rand.Text()), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Log.Fatal("Failed to hash dummy password", zap.Error(err))
+	}
+	return hash
+})
+
+func freeAttempts() int {
+	if n := config.GlobalConfig.Auth.Lockout.FreeAttempts; n > 0 {
+		return n
+	}
+	return defaultFreeAttempts
+}
+
+func maxAttempts() int {
+	if n := config.GlobalConfig.Auth.Lockout.MaxAttempts; n > 0 {
+		return n
+	}
+	return defaultMaxAttempts
+}
+
+// loginDelay is how long to wait after the nth failure.
+func loginDelay(failures int) time.Duration {
+	over := failures - freeAttempts()
+	if over < 0 {
+		return 0
+	}
+	base := parseDuration(config.GlobalConfig.Auth.Lockout.Delay, defaultLoginDelay)
+	delay := time.Duration(float64(base) * math.Pow(2, float64(over)))
+	return min(delay, maxLoginDelay)
+}
+
+func tooManyAttempts(wait time.Duration) error {
+	return status.Error(codes.ResourceExhausted,
+		fmt.Sprintf("too many failed logins, try again in %ds", int(math.Ceil(wait.Seconds()))))
+}
+
+// checkLoginAllowed refuses logins of a locked username, and those coming
+// sooner than the delay after the last failure allows.
+func checkLoginAllowed(ctx context.Context, username string) error {
+	locked, err := cache.LoginLockedFor(ctx, username)
+	if err != nil {
+		return err
+	}
+	if locked > 0 {
+		return tooManyAttempts(locked)
+	}
+
+	failures, err := cache.GetLoginFailures(ctx, username)
+	if err != nil {
+		return err
+	}
+	if wait := time.Until(failures.Last.Add(loginDelay(failures.Count))); failures.Count > 0 && wait > 0 {
+		return tooManyAttempts(wait)
+	}
+	return nil
+}
+
+// loginFailed counts a failed password or MFA code, locking the username once
+// there are too many. Unknown usernames count too, so they look the same.
+func loginFailed(ctx context.Context, username string, userID uint, ip string) {
+	window := parseDuration(config.GlobalConfig.Auth.Lockout.Window, defaultFailureWindow)
+	failures, err := cache.RecordLoginFailure(ctx, username, window)
+	if err != nil {
+		logger.Log.Error("Failed to record login failure", zap.Error(err))
+		return
+	}
+	if failures < maxAttempts() {
+		return
+	}
+
+	duration := parseDuration(config.GlobalConfig.Auth.Lockout.Duration, defaultLockoutDuration)
+	if err := cache.LockLogin(ctx, username, duration); err != nil {
+		logger.Log.Error("Failed to lock login", zap.Error(err))
+		return
+	}
+	logger.Audit("account_locked",
+		zap.String("username", username),
+		zap.Uint("user_id", userID),
+		zap.String("ip", ip),
+		zap.Int("failures", failures),
+		zap.Duration("duration", duration),
+	)
+}
+
+func loginSucceeded(ctx context.Context, username string) {
+	if err := cache.ClearLoginFailures(ctx, username); err != nil {
+		logger.Log.Warn("Failed to clear login failures", zap.Error(err))
+	}
+}
@@ -0,0 +1,312 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/internal/cache"
+	"github.com/yeliheng/go-ai-gateway/internal/database"
+	"github.com/yeliheng/go-ai-gateway/internal/totp"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+var (
+	errInvalidMFAToken = status.Error(codes.Unauthenticated, "invalid or expired MFA token")
+	errInvalidMFACode  = status.Error(codes.Unauthenticated, "invalid code")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// enabledTOTP returns the confirmed TOTP enrollment of a user, nil if MFA is
+// off.
+func enabledTOTP(ctx context.Context, userID uint) (*model.TOTP, error) {
+	var t model.TOTP
+	err := database.DB.WithContext(ctx).Where("user_id = ? AND confirmed_at IS NOT NULL", userID).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// mfaChallenge answers a login that passed the password check but needs a
+// second factor.
+func mfaChallenge(ctx context.Context, user *model.User, ip, userAgent string) (*identityv1.LoginResponse, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	ch := &cache.MFAChallenge{UserID: user.ID, IP: ip, UserAgent: userAgent}
+	if err := cache.SaveMFAChallenge(ctx, token, ch, mfaChallengeTTL); err != nil {
+		return nil, err
+	}
+	return &identityv1.LoginResponse{
+		Username:    user.Username,
+		MfaRequired: true,
+		MfaToken:    token,
+	}, nil
+}
+
+func (s *Server) VerifyMFA(ctx context.Context, req *identityv1.VerifyMFARequest) (*identityv1.LoginResponse, error) {
+	ch, err := cache.AttemptMFAChallenge(ctx, req.MfaToken, maxMFAAttempts)
+	if err != nil {
+		logger.Log.Error("MFA verification failed: redis error", zap.Error(err))
+		return nil, err
+	}
+	if ch == nil {
+		return nil, errInvalidMFAToken
+	}
+
+	var user model.User
+	if err := database.DB.WithContext(ctx).Preload("Role").First(&user, ch.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidMFAToken
+		}
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, errAccountDisabled
+	}
+	// Codes are guessed against the same per-username limit as passwords
+	if err := checkLoginAllowed(ctx, user.Username); err != nil {
+		return nil, err
+	}
+
+	t, err := enabledTOTP(ctx, ch.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// MFA was disabled meanwhile, start over
+	if t == nil {
+		cache.ConsumeMFAChallenge(ctx, req.MfaToken)
+		return nil, errInvalidMFAToken
+	}
+	ok, err := checkSecondFactor(ctx, t, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		loginFailed(ctx, user.Username, user.ID, ch.IP)
+		return nil, errInvalidMFACode
+	}
+
+	if consumed, err := cache.ConsumeMFAChallenge(ctx, req.MfaToken); err != nil || !consumed {
+		return nil, errInvalidMFAToken
+	}
+
+	loginSucceeded(ctx, user.Username)
+	return s.login(ctx, &user, ch.IP, ch.UserAgent)
+}
+
+// checkSecondFactor checks a TOTP or recovery code and uses it up.
+func checkSecondFactor(ctx context.Context, t *model.TOTP, code string) (bool, error) {
+	code = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(code))
+
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(t.Secret, code, time.Now(), t.LastStep)
+		if !ok {
+			return false, nil
+		}
+		// Only one of concurrent requests can move last_step past a code
+		res := database.DB.WithContext(ctx).Model(&model.TOTP{}).
+			Where("id = ? AND last_step < ?", t.ID, step).
+			UpdateColumn("last_step", step)
+		return res.RowsAffected == 1, res.Error
+	}
+
+	used := false
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked model.TOTP
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, t.ID).Error; err != nil {
+			return err
+		}
+		i := slices.Index(locked.RecoveryCodes, hashRecoveryCode(code))
+		if i < 0 {
+			return nil
+		}
+		used = true
+		locked.RecoveryCodes = slices.Delete(locked.RecoveryCodes, i, i+1)
+		logger.Log.Info("Recovery code used", zap.Uint("user_id", locked.UserID), zap.Int("remaining", len(locked.RecoveryCodes)))
+		return tx.Model(&locked).Select("recovery_codes").Updates(&locked).Error
+	})
+	return used, err
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRecoveryCodes returns codes formatted for display, and their hashes.
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := recoveryEncoding.EncodeToString(b)
+		codes = append(codes, strings.ToLower(code[:4]+"-"+code[4:]))
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func (s *Server) EnrollTOTP(ctx context.Context, req *identityv1.EnrollTOTPRequest) (*identityv1.EnrollTOTPResponse, error) {
+	userID, err := strconv.ParseUint(req.UserId, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	var user model.User
+	if err := database.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	t, err := enabledTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		return nil, status.Error(codes.FailedPrecondition, "TOTP is already enabled")
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	// Replaces an unconfirmed enrollment
+	pending := model.TOTP{UserID: user.ID, Secret: secret}
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&model.TOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&pending).Error
+	})
+	if err != nil {
+		logger.Log.Error("Failed to save TOTP enrollment", zap.Error(err))
+		return nil, err
+	}
+
+	issuer := config.GlobalConfig.App.Name
+	if issuer == "" {
+		issuer = "ai-gateway"
+	}
+	return &identityv1.EnrollTOTPResponse{
+		Secret: secret,
+		Uri:    totp.URI(issuer, user.Username, secret),
+	}, nil
+}
+
+// mfaUser loads the user changing their MFA settings. Codes checked for it are
+// guessed against the same per-username limit as passwords, a stolen session
+// mustn't be enough to brute-force them.
+func mfaUser(ctx context.Context, rawID string) (*model.User, error) {
+	userID, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	var user model.User
+	if err := database.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, err
+	}
+	if err := checkLoginAllowed(ctx, user.Username); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *Server) ConfirmTOTP(ctx context.Context, req *identityv1.ConfirmTOTPRequest) (*identityv1.ConfirmTOTPResponse, error) {
+	user, err := mfaUser(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	var t model.TOTP
+	err = database.DB.WithContext(ctx).Where("user_id = ?", user.ID).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Error(codes.FailedPrecondition, "TOTP enrollment not started")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled() {
+		return nil, status.Error(codes.FailedPrecondition, "TOTP is already enabled")
+	}
+
+	step, ok := totp.Validate(t.Secret, req.Code, time.Now(), t.LastStep)
+	if !ok {
+		loginFailed(ctx, user.Username, user.ID, "")
+		return nil, status.Error(codes.InvalidArgument, "invalid code")
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	t.ConfirmedAt = &now
+	t.LastStep = step
+	t.RecoveryCodes = hashes
+	if err := database.DB.WithContext(ctx).Save(&t).Error; err != nil {
+		logger.Log.Error("Failed to enable TOTP", zap.Error(err))
+		return nil, err
+	}
+
+	logger.Log.Info("TOTP enabled", zap.Uint("user_id", t.UserID))
+	return &identityv1.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *Server) DisableTOTP(ctx context.Context, req *identityv1.DisableTOTPRequest) (*identityv1.DisableTOTPResponse, error) {
+	user, err := mfaUser(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	t, err := enabledTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, status.Error(codes.FailedPrecondition, "TOTP is not enabled")
+	}
+
+	ok, err := checkSecondFactor(ctx, t, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		loginFailed(ctx, user.Username, user.ID, "")
+		return nil, status.Error(codes.InvalidArgument, "invalid code")
+	}
+
+	if err := database.DB.WithContext(ctx).Unscoped().Delete(t).Error; err != nil {
+		return nil, err
+	}
+	logger.Log.Info("TOTP disabled", zap.Uint("user_id", t.UserID))
+	return &identityv1.DisableTOTPResponse{}, nil
+}
@@ -0,0 +1,209 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/internal/cache"
+	"github.com/yeliheng/go-ai-gateway/internal/database"
+	"github.com/yeliheng/go-ai-gateway/internal/notify"
+	"github.com/yeliheng/go-ai-gateway/internal/password"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const defaultResetTokenTTL = 30 * time.Minute
+
+var errInvalidResetToken = status.Error(codes.Unauthenticated, "invalid or expired reset token")
+
+// checkPolicy returns InvalidArgument for passwords the policy rejects.
+func (s *Server) checkPolicy(newPassword, username string) error {
+	err := s.policy.Validate(newPassword, username)
+	if password.IsPolicyError(err) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return err
+}
+
+// setPassword validates and stores a new password.
+func (s *Server) setPassword(ctx context.Context, user *model.User, newPassword string) error {
+	if err := s.checkPolicy(newPassword, user.Username); err != nil {
+		return err
+	}
+	return storePassword(ctx, user, newPassword)
+}
+
+// storePassword hashes and stores a password that passed the policy.
+func storePassword(ctx context.Context, user *model.User, newPassword string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return database.DB.WithContext(ctx).Model(user).Update("password", string(hash)).Error
+}
+
+func (s *Server) ChangePassword(ctx context.Context, req *identityv1.ChangePasswordRequest) (*identityv1.ChangePasswordResponse, error) {
+	userID, err := strconv.ParseUint(req.UserId, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	var user model.User
+	if err := database.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		return nil, err
+	}
+	// SSO users have no password to check against, they can use a reset
+	if user.Password == "" {
+		return nil, status.Error(codes.FailedPrecondition, "account has no password")
+	}
+
+	// The current password can be guessed here as well as on /login
+	if err := checkLoginAllowed(ctx, user.Username); err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		loginFailed(ctx, user.Username, user.ID, "")
+		return nil, status.Error(codes.PermissionDenied, "current password is wrong")
+	}
+
+	if err := s.setPassword(ctx, &user, req.NewPassword); err != nil {
+		return nil, err
+	}
+
+	sessions, err := cache.ListSessions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	var revoked int32
+	for _, session := range sessions {
+		if session.ID == req.SessionId {
+			continue
+		}
+		if err := revokeSession(ctx, user.ID, session.ID); err != nil {
+			logger.Log.Error("Failed to revoke session", zap.Error(err))
+			continue
+		}
+		revoked++
+	}
+
+	logger.Log.Info("Password changed", zap.Uint("user_id", user.ID), zap.Int32("revoked_sessions", revoked))
+	return &identityv1.ChangePasswordResponse{Revoked: revoked}, nil
+}
+
+func (s *Server) RequestPasswordReset(ctx context.Context, req *identityv1.RequestPasswordResetRequest) (*identityv1.RequestPasswordResetResponse, error) {
+	login := strings.TrimSpace(req.Login)
+	if login == "" {
+		return nil, status.Error(codes.InvalidArgument, "login is required")
+	}
+
+	var user model.User
+	query := database.DB.WithContext(ctx).Where("username = ?", login)
+	if strings.Contains(login, "@") {
+		query = database.DB.WithContext(ctx).Where("username = ? OR email = ?", login, login)
+	}
+	err := query.First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Don't tell whether the account exists
+		return &identityv1.RequestPasswordResetResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	ttl := parseDuration(config.GlobalConfig.Auth.Password.ResetTokenTTL, defaultResetTokenTTL)
+	if err := cache.SavePasswordResetToken(ctx, token, user.ID, ttl); err != nil {
+		return nil, err
+	}
+
+	msg := notify.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of %s.\n\nOpen %s within %s to choose a new one. "+
+			"If it wasn't you, ignore this message.\n", user.Username, resetLink(token), ttl),
+	}
+	// Sent in the background so the response time doesn't reveal the account
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.notifier.Send(ctx, msg); err != nil {
+			logger.Log.Warn("Failed to send password reset", zap.Uint("user_id", user.ID), zap.Error(err))
+		}
+	}()
+
+	logger.Log.Info("Password reset requested", zap.Uint("user_id", user.ID))
+	return &identityv1.RequestPasswordResetResponse{}, nil
+}
+
+func resetLink(token string) string {
+	base := config.GlobalConfig.Auth.Password.ResetURL
+	if base == "" {
+		base = "/login"
+	}
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(token)
+}
+
+func (s *Server) ResetPassword(ctx context.Context, req *identityv1.ResetPasswordRequest) (*identityv1.ResetPasswordResponse, error) {
+	userID, err := cache.GetPasswordResetToken(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	if userID == 0 {
+		return nil, errInvalidResetToken
+	}
+	var user model.User
+	if err := database.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidResetToken
+		}
+		return nil, err
+	}
+
+	// Check the new password before using up the token, so a weak choice
+	// can be retried with the same link
+	if err := s.checkPolicy(req.NewPassword, user.Username); err != nil {
+		return nil, err
+	}
+	used, err := cache.UsePasswordResetToken(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	if used != user.ID {
+		return nil, errInvalidResetToken
+	}
+
+	if err := storePassword(ctx, &user, req.NewPassword); err != nil {
+		return nil, err
+	}
+
+	// Whoever knew the old password is logged out
+	if _, err := revokeAllSessions(ctx, user.ID); err != nil {
+		logger.Log.Error("Failed to revoke sessions", zap.Error(err))
+	}
+	loginSucceeded(ctx, user.Username)
+
+	logger.Log.Info("Password reset", zap.Uint("user_id", user.ID))
+	return &identityv1.ResetPasswordResponse{}, nil
+}
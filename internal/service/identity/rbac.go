@@ -0,0 +1,98 @@
+package identity
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/internal/database"
+
+	"go.uber.org/zap"
+)
+
+// Role permissions are looked up on every token validation; changes made in
+// the database apply after at most this long.
+const permissionCacheTTL = 30 * time.Second
+
+// DefaultRole is assigned to newly registered users.
+const DefaultRole = "user"
+
+// defaultRoles are created on startup if missing. Existing roles are left
+// alone so permissions changed by an administrator stick.
+var defaultRoles = map[string][]string{
+	DefaultRole: {model.PermChatUse, model.ModelPermission("mock")},
+	"premium":   {model.PermChatUse, model.PermModelAll},
+	"admin": {
+		model.PermChatUse,
+		model.PermModelAll,
+		model.PermAdminUsers,
+		model.PermAdminBroadcast,
+		model.PermAdminMetrics,
+	},
+}
+
+var permissionDescriptions = map[string]string{
+	model.PermChatUse:             "Chat over WebSocket and SSE",
+	model.ModelPermission("mock"): "Use the mock model",
+	model.PermModelAll:            "Use every model",
+	model.PermAdminUsers:          "Manage users",
+	model.PermAdminBroadcast:      "Broadcast system messages",
+	model.PermAdminMetrics:        "Read server metrics",
+}
+
+// SeedRoles creates the default roles and their permissions.
+func SeedRoles() error {
+	for name, perms := range defaultRoles {
+		var role model.Role
+		if err := database.DB.Preload("Permissions").FirstOrCreate(&role, model.Role{Name: name}).Error; err != nil {
+			return err
+		}
+		if len(role.Permissions) > 0 {
+			continue
+		}
+
+		var permissions []model.Permission
+		for _, p := range perms {
+			permission := model.Permission{Name: p, Description: permissionDescriptions[p]}
+			if err := database.DB.FirstOrCreate(&permission, model.Permission{Name: p}).Error; err != nil {
+				return err
+			}
+			permissions = append(permissions, permission)
+		}
+		if err := database.DB.Model(&role).Association("Permissions").Append(permissions); err != nil {
+			return err
+		}
+		logger.Log.Info("Seeded role", zap.String("role", name), zap.Strings("permissions", perms))
+	}
+	return nil
+}
+
+type cachedPermissions struct {
+	permissions []string
+	expires     time.Time
+}
+
+var permissionCache sync.Map // role name -> cachedPermissions
+
+// rolePermissions returns the permission names granted to a role.
+func rolePermissions(roleName string) ([]string, error) {
+	if v, ok := permissionCache.Load(roleName); ok {
+		if cached := v.(cachedPermissions); time.Now().Before(cached.expires) {
+			return cached.permissions, nil
+		}
+	}
+
+	var role model.Role
+	err := database.DB.Preload("Permissions").Where("name = ?", roleName).Limit(1).Find(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		permissions = append(permissions, p.Name)
+	}
+
+	permissionCache.Store(roleName, cachedPermissions{permissions: permissions, expires: time.Now().Add(permissionCacheTTL)})
+	return permissions, nil
+}
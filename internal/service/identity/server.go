@@ -4,32 +4,81 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"time"
+	"net/mail"
+	"strconv"
+	"strings"
 
 	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
 	"github.com/yeliheng/go-ai-gateway/common/config"
 	"github.com/yeliheng/go-ai-gateway/common/model"
 	"github.com/yeliheng/go-ai-gateway/internal/cache"
 	"github.com/yeliheng/go-ai-gateway/internal/database"
+	"github.com/yeliheng/go-ai-gateway/internal/jwtkeys"
+	"github.com/yeliheng/go-ai-gateway/internal/notify"
+	"github.com/yeliheng/go-ai-gateway/internal/password"
 
 	"github.com/yeliheng/go-ai-gateway/common/logger"
 
-	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"gorm.io/gorm"
 )
 
 type Server struct {
 	identityv1.UnimplementedIdentityServiceServer
+
+	// Keys access tokens are signed with
+	keys *jwtkeys.KeySet
+
+	policy *password.Policy
+	// Delivers password reset links
+	notifier notify.Notifier
 }
 
 func NewIdentityServer() *Server {
-	return &Server{}
+	keys, ephemeral, err := jwtkeys.Load(config.GlobalConfig.JWT)
+	if err != nil {
+		logger.Log.Fatal("Failed to load JWT keys", zap.Error(err))
+	}
+	if ephemeral {
+		logger.Log.Warn("No JWT keys configured, signing with an ephemeral key; tokens won't survive a restart")
+	}
+	if err := SeedRoles(); err != nil {
+		logger.Log.Error("Failed to seed default roles", zap.Error(err))
+	}
+	dummyPasswordHash() // Computed up front so the first unknown user isn't slower
+
+	passwordCfg := config.GlobalConfig.Auth.Password
+	policy, err := password.LoadPolicy(passwordCfg)
+	if err != nil {
+		logger.Log.Fatal("Failed to load password policy", zap.Error(err))
+	}
+	notifier, err := notify.New(passwordCfg.Notifier, passwordCfg.SMTP)
+	if err != nil {
+		logger.Log.Fatal("Failed to set up notifier", zap.Error(err))
+	}
+	if _, ok := notifier.(notify.LogNotifier); ok {
+		logger.Log.Warn("Password reset links are written to the log, configure auth.password.notifier for production")
+	}
+	return &Server{keys: keys, policy: policy, notifier: notifier}
 }
 
 func (s *Server) Register(ctx context.Context, req *identityv1.RegisterRequest) (*identityv1.RegisterResponse, error) {
 	logger.Log.Info("Register request received", zap.String("username", req.Username))
+	if err := s.checkPolicy(req.Password, req.Username); err != nil {
+		return nil, err
+	}
+	email := strings.TrimSpace(req.Email)
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid email address")
+		}
+		email = addr.Address
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		logger.Log.Error("Failed to hash password", zap.Error(err))
@@ -38,7 +87,7 @@ func (s *Server) Register(ctx context.Context, req *identityv1.RegisterRequest)
 
 	// Default role: user
 	var role model.Role
-	if err := database.DB.FirstOrCreate(&role, model.Role{Name: "user"}).Error; err != nil {
+	if err := database.DB.FirstOrCreate(&role, model.Role{Name: DefaultRole}).Error; err != nil {
 		logger.Log.Error("Failed to create role", zap.Error(err))
 		return nil, err
 	}
@@ -46,6 +95,7 @@ func (s *Server) Register(ctx context.Context, req *identityv1.RegisterRequest)
 	user := model.User{
 		Username: req.Username,
 		Password: string(hashedPassword),
+		Email:    email,
 		RoleID:   role.ID,
 	}
 
@@ -62,74 +112,250 @@ func (s *Server) Register(ctx context.Context, req *identityv1.RegisterRequest)
 }
 
 func (s *Server) Login(ctx context.Context, req *identityv1.LoginRequest) (*identityv1.LoginResponse, error) {
-	logger.Log.Info("Login request received", zap.String("username", req.Username))
+	logger.Log.Debug("Login request received", zap.String("username", req.Username))
+	if err := checkLoginAllowed(ctx, req.Username); err != nil {
+		return nil, err
+	}
+
 	var user model.User
-	if err := database.DB.Preload("Role").Where("username = ?", req.Username).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Log.Warn("Login failed: user not found", zap.String("username", req.Username))
-			return nil, errors.New("invalid credentials")
-		}
+	err := database.DB.Preload("Role").Where("username = ?", req.Username).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		logger.Log.Error("Login failed: db error", zap.Error(err))
 		return nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, errors.New("invalid credentials")
+	// Unknown users and users without a password (SSO only) go through bcrypt
+	// too, so the response time doesn't tell whether a username exists
+	hash := []byte(user.Password)
+	if user.ID == 0 || user.Password == "" {
+		hash = dummyPasswordHash()
 	}
-
-	expiry := time.Duration(config.GlobalConfig.JWT.ExpiryDays) * 24 * time.Hour
-	expiresAt := time.Now().Add(expiry)
-	claims := jwt.MapClaims{
-		"sub":  user.ID,
-		"role": user.Role.Name,
-		"exp":  expiresAt.Unix(),
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)); err != nil || user.ID == 0 || user.Password == "" {
+		loginFailed(ctx, req.Username, user.ID, req.Ip)
+		return nil, errInvalidCredentials
+	}
+	if user.DisabledAt != nil {
+		return nil, errAccountDisabled
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.GlobalConfig.JWT.Secret))
+	t, err := enabledTOTP(ctx, user.ID)
 	if err != nil {
 		return nil, err
 	}
+	if t != nil {
+		return mfaChallenge(ctx, &user, req.Ip, req.UserAgent)
+	}
+	loginSucceeded(ctx, user.Username)
+	return s.login(ctx, &user, req.Ip, req.UserAgent)
+}
 
-	err = cache.SetToken(ctx, tokenString, user.ID, expiry)
+// login starts a session for an authenticated user and issues its tokens.
+func (s *Server) login(ctx context.Context, user *model.User, ip, userAgent string) (*identityv1.LoginResponse, error) {
+	sid, err := newSession(ctx, user, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := s.issueTokens(ctx, user, sid)
 	if err != nil {
 		return nil, err
 	}
 
 	return &identityv1.LoginResponse{
-		Token:     tokenString,
-		Username:  user.Username,
-		Role:      user.Role.Name,
-		ExpiresAt: expiresAt.Unix(),
+		Token:            pair.AccessToken,
+		Username:         user.Username,
+		Role:             user.Role.Name,
+		ExpiresAt:        pair.ExpiresAt.Unix(),
+		RefreshToken:     pair.RefreshToken,
+		RefreshExpiresAt: pair.RefreshExpiresAt.Unix(),
 	}, nil
 }
 
-func (s *Server) ValidateToken(ctx context.Context, req *identityv1.ValidateTokenRequest) (*identityv1.ValidateTokenResponse, error) {
-	token, err := jwt.Parse(req.Token, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.GlobalConfig.JWT.Secret), nil
-	})
+var errInvalidRefreshToken = status.Error(codes.Unauthenticated, "invalid refresh token")
 
-	if err != nil || !token.Valid {
-		return &identityv1.ValidateTokenResponse{Valid: false}, nil
+func (s *Server) Refresh(ctx context.Context, req *identityv1.RefreshRequest) (*identityv1.RefreshResponse, error) {
+	rt, reused, err := cache.UseRefreshToken(ctx, req.RefreshToken)
+	if err != nil {
+		logger.Log.Error("Refresh failed: redis error", zap.Error(err))
+		return nil, err
+	}
+	if rt == nil {
+		return nil, errInvalidRefreshToken
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
+	// A used token coming back means it leaked, log out everything issued from that login
+	if reused {
+		logger.Log.Warn("Refresh token reuse detected, revoking session", zap.Uint("user_id", rt.UserID), zap.String("session_id", rt.SessionID))
+		if err := revokeSession(ctx, rt.UserID, rt.SessionID); err != nil {
+			logger.Log.Error("Failed to revoke session", zap.Error(err))
+		}
+		return nil, errInvalidRefreshToken
+	}
+
+	active, err := cache.SessionActive(ctx, rt.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, errInvalidRefreshToken
+	}
+
+	var user model.User
+	if err := database.DB.Preload("Role").First(&user, rt.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			revokeSession(ctx, rt.UserID, rt.SessionID)
+			return nil, errInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		revokeSession(ctx, rt.UserID, rt.SessionID)
+		return nil, errInvalidRefreshToken
+	}
+
+	pair, err := s.issueTokens(ctx, &user, rt.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identityv1.RefreshResponse{
+		Token:            pair.AccessToken,
+		ExpiresAt:        pair.ExpiresAt.Unix(),
+		RefreshToken:     pair.RefreshToken,
+		RefreshExpiresAt: pair.RefreshExpiresAt.Unix(),
+	}, nil
+}
+
+func (s *Server) Logout(ctx context.Context, req *identityv1.LogoutRequest) (*identityv1.LogoutResponse, error) {
+	claims, err := s.keys.Parse(req.Token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	sid, _ := claims["sid"].(string)
+	if sid == "" {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	userID, _ := strconv.ParseUint(subject(claims), 10, 64)
+	if err := revokeSession(ctx, uint(userID), sid); err != nil {
+		logger.Log.Error("Failed to revoke session", zap.Error(err))
+		return nil, err
+	}
+
+	return &identityv1.LogoutResponse{}, nil
+}
+
+func (s *Server) RevokeAllSessions(ctx context.Context, req *identityv1.RevokeAllSessionsRequest) (*identityv1.RevokeAllSessionsResponse, error) {
+	userID, err := strconv.ParseUint(req.UserId, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+
+	revoked, err := revokeAllSessions(ctx, uint(userID))
+	if err != nil {
+		logger.Log.Error("Failed to revoke sessions", zap.Uint64("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	logger.Log.Info("Revoked all sessions", zap.Uint64("user_id", userID), zap.Int("count", revoked))
+	return &identityv1.RevokeAllSessionsResponse{Revoked: int32(revoked)}, nil
+}
+
+func (s *Server) ListSessions(ctx context.Context, req *identityv1.ListSessionsRequest) (*identityv1.ListSessionsResponse, error) {
+	userID, err := strconv.ParseUint(req.UserId, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+
+	sessions, err := cache.ListSessions(ctx, uint(userID))
+	if err != nil {
+		logger.Log.Error("Failed to list sessions", zap.Uint64("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+
+	resp := &identityv1.ListSessionsResponse{}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &identityv1.Session{
+			Id:         session.ID,
+			Ip:         session.IP,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt.Unix(),
+			LastSeenAt: session.LastSeen.Unix(),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) RevokeSession(ctx context.Context, req *identityv1.RevokeSessionRequest) (*identityv1.RevokeSessionResponse, error) {
+	session, err := cache.GetSession(ctx, req.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	// Sessions of other users are reported as missing too
+	if session == nil || fmt.Sprint(session.UserID) != req.UserId {
+		return nil, status.Error(codes.NotFound, "session not found")
+	}
+
+	if err := revokeSession(ctx, session.UserID, session.ID); err != nil {
+		logger.Log.Error("Failed to revoke session", zap.Error(err))
+		return nil, err
+	}
+	return &identityv1.RevokeSessionResponse{}, nil
+}
+
+func (s *Server) GetJWKS(ctx context.Context, req *identityv1.GetJWKSRequest) (*identityv1.GetJWKSResponse, error) {
+	resp := &identityv1.GetJWKSResponse{}
+	for _, k := range s.keys.JWKS().Keys {
+		resp.Keys = append(resp.Keys, &identityv1.JWK{
+			Kty: k.Kty,
+			Kid: k.Kid,
+			Use: k.Use,
+			Alg: k.Alg,
+			N:   k.N,
+			E:   k.E,
+			Crv: k.Crv,
+			X:   k.X,
+			Y:   k.Y,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) ValidateToken(ctx context.Context, req *identityv1.ValidateTokenRequest) (*identityv1.ValidateTokenResponse, error) {
+	if strings.HasPrefix(req.Token, model.APIKeyPrefix) {
+		return s.validateAPIKey(ctx, req.Token)
+	}
+
+	claims, err := s.keys.Parse(req.Token)
+	if err != nil {
 		return &identityv1.ValidateTokenResponse{Valid: false}, nil
 	}
 
-	userID, _ := claims["sub"].(string)
+	username, _ := claims["preferred_username"].(string)
 	role, _ := claims["role"].(string)
+	sid, _ := claims["sid"].(string)
+	jti, _ := claims["jti"].(string)
 
-	cachedUserID, err := cache.GetToken(ctx, req.Token)
-	if err != nil || cachedUserID != userID {
+	valid, err := cache.ValidateSessionToken(ctx, sid, jti)
+	if err != nil {
+		logger.Log.Error("Token validation failed: redis error", zap.Error(err))
+		return nil, err
+	}
+	if !valid {
 		return &identityv1.ValidateTokenResponse{Valid: false}, nil
 	}
 
+	permissions, err := rolePermissions(role)
+	if err != nil {
+		logger.Log.Error("Token validation failed: db error", zap.Error(err))
+		return nil, err
+	}
+
 	return &identityv1.ValidateTokenResponse{
-		Valid:    true,
-		UserId:   userID,
-		Username: "", // Context doesn't strictly need username here, but we could fetch it if needed
-		Role:     role,
+		Valid:       true,
+		UserId:      subject(claims),
+		Username:    username,
+		Role:        role,
+		SessionId:   sid,
+		Permissions: permissions,
 	}, nil
 }
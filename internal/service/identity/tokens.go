@@ -0,0 +1,152 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/internal/cache"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 7 * 24 * time.Hour
+)
+
+type tokenPair struct {
+	AccessToken      string
+	ExpiresAt        time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+func accessTTL() time.Duration {
+	return parseDuration(config.GlobalConfig.JWT.AccessTTL, defaultAccessTTL)
+}
+
+func refreshTTL() time.Duration {
+	def := defaultRefreshTTL
+	if days := config.GlobalConfig.JWT.ExpiryDays; days > 0 {
+		def = time.Duration(days) * 24 * time.Hour
+	}
+	return parseDuration(config.GlobalConfig.JWT.RefreshTTL, def)
+}
+
+func parseDuration(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		logger.Log.Warn("Invalid duration in config, using default", zap.String("value", s), zap.Duration("default", def))
+		return def
+	}
+	return d
+}
+
+// newSession starts a login session for user.
+func newSession(ctx context.Context, user *model.User, ip, userAgent string) (string, error) {
+	sid := uuid.New().String()
+	err := cache.CreateSession(ctx, &cache.Session{
+		ID:        sid,
+		UserID:    user.ID,
+		IP:        ip,
+		UserAgent: userAgent,
+	}, refreshTTL())
+	return sid, err
+}
+
+// issueTokens signs an access token for user and creates a refresh token in
+// session sid. Access tokens issued before for the session stop being valid.
+func (s *Server) issueTokens(ctx context.Context, user *model.User, sid string) (*tokenPair, error) {
+	now := time.Now()
+	jti := uuid.New().String()
+	pair := &tokenPair{
+		ExpiresAt:        now.Add(accessTTL()),
+		RefreshExpiresAt: now.Add(refreshTTL()),
+	}
+
+	claims := jwt.MapClaims{
+		"sub":                fmt.Sprint(user.ID),
+		"preferred_username": user.Username,
+		"role":               user.Role.Name,
+		"sid":                sid, // Login session, shared by every token rotated from it
+		"jti":                jti,
+		"exp":                pair.ExpiresAt.Unix(),
+	}
+	accessToken, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	// The session may have been revoked since the caller checked it
+	ok, err := cache.SetSessionToken(ctx, sid, user.ID, jti, refreshTTL())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errInvalidRefreshToken
+	}
+	pair.AccessToken = accessToken
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := cache.SaveRefreshToken(ctx, refreshToken, user.ID, sid, refreshTTL()); err != nil {
+		return nil, err
+	}
+	pair.RefreshToken = refreshToken
+
+	return pair, nil
+}
+
+// subject returns the user ID in the sub claim. Older tokens carry it as a
+// number instead of a string.
+func subject(claims jwt.MapClaims) string {
+	switch sub := claims["sub"].(type) {
+	case string:
+		return sub
+	case float64:
+		return strconv.FormatUint(uint64(sub), 10)
+	}
+	return ""
+}
+
+// revokeSession revokes a login session and tells the biz replicas to close
+// connections using it.
+func revokeSession(ctx context.Context, userID uint, sid string) error {
+	if err := cache.DeleteSession(ctx, sid); err != nil {
+		return err
+	}
+	return cache.PublishRevocation(ctx, cache.Revocation{UserID: fmt.Sprint(userID), SessionID: sid})
+}
+
+// revokeAllSessions revokes every login session of a user and closes its
+// connections, including those made with API keys. The API keys themselves
+// stay valid.
+func revokeAllSessions(ctx context.Context, userID uint) (int, error) {
+	revoked, err := cache.DeleteUserSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return revoked, cache.PublishRevocation(ctx, cache.Revocation{UserID: fmt.Sprint(userID)})
+}
+
+// randomToken returns an opaque 256-bit token.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
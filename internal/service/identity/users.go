@@ -0,0 +1,203 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/api/gen/identity/v1"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/internal/database"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUsersPageSize = 20
+	maxUsersPageSize     = 100
+)
+
+var (
+	errUserNotFound    = status.Error(codes.NotFound, "user not found")
+	errAccountDisabled = status.Error(codes.PermissionDenied, "account disabled")
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func userInfo(user *model.User, mfaEnabled bool) *identityv1.User {
+	info := &identityv1.User{
+		Id:         fmt.Sprint(user.ID),
+		Username:   user.Username,
+		Email:      user.Email,
+		Role:       user.Role.Name,
+		Disabled:   user.DisabledAt != nil,
+		MfaEnabled: mfaEnabled,
+		CreatedAt:  user.CreatedAt.Unix(),
+	}
+	if user.DeletedAt.Valid {
+		info.DeletedAt = user.DeletedAt.Time.Unix()
+	}
+	return info
+}
+
+func (s *Server) ListUsers(ctx context.Context, req *identityv1.ListUsersRequest) (*identityv1.ListUsersResponse, error) {
+	pageSize := int(req.PageSize)
+	if pageSize <= 0 {
+		pageSize = defaultUsersPageSize
+	}
+	pageSize = min(pageSize, maxUsersPageSize)
+	page := max(int(req.Page), 1)
+
+	query := database.DB.WithContext(ctx).Model(&model.User{})
+	if req.IncludeDeleted {
+		query = query.Unscoped()
+	}
+	if q := strings.TrimSpace(req.Query); q != "" {
+		pattern := "%" + likeEscaper.Replace(q) + "%"
+		query = query.Where("users.username ILIKE ? OR users.email ILIKE ?", pattern, pattern)
+	}
+	if req.Role != "" {
+		query = query.Joins("JOIN roles ON roles.id = users.role_id").Where("roles.name = ?", req.Role)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var users []model.User
+	if err := query.Preload("Role").Order("users.id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(users))
+	for i := range users {
+		ids[i] = users[i].ID
+	}
+	var withMFA []uint
+	if err := database.DB.WithContext(ctx).Model(&model.TOTP{}).
+		Where("user_id IN ? AND confirmed_at IS NOT NULL", ids).Pluck("user_id", &withMFA).Error; err != nil {
+		return nil, err
+	}
+
+	resp := &identityv1.ListUsersResponse{Total: total}
+	for i := range users {
+		resp.Users = append(resp.Users, userInfo(&users[i], slices.Contains(withMFA, users[i].ID)))
+	}
+	return resp, nil
+}
+
+// adminTarget loads the user an admin action applies to.
+func adminTarget(ctx context.Context, actorID, userID string) (*model.User, error) {
+	if actorID == userID {
+		return nil, status.Error(codes.FailedPrecondition, "admins can't change their own account here")
+	}
+	id, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user_id")
+	}
+	var user model.User
+	err = database.DB.WithContext(ctx).Preload("Role").First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errUserNotFound
+	}
+	return &user, err
+}
+
+func (s *Server) SetUserRole(ctx context.Context, req *identityv1.SetUserRoleRequest) (*identityv1.SetUserRoleResponse, error) {
+	user, err := adminTarget(ctx, req.ActorId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var role model.Role
+	err = database.DB.WithContext(ctx).Where("name = ?", req.Role).First(&role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, status.Error(codes.InvalidArgument, "unknown role")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.RoleID != role.ID {
+		previous := user.Role.Name
+		if err := database.DB.WithContext(ctx).Model(user).Update("role_id", role.ID).Error; err != nil {
+			return nil, err
+		}
+		user.Role = role
+		// Tokens carry the role, the user has to log in again to get the new one
+		if _, err := revokeAllSessions(ctx, user.ID); err != nil {
+			logger.Log.Error("Failed to revoke sessions", zap.Error(err))
+		}
+		logger.Audit("user_role_changed",
+			zap.String("actor_id", req.ActorId),
+			zap.Uint("user_id", user.ID),
+			zap.String("from", previous),
+			zap.String("to", role.Name),
+		)
+	}
+
+	mfa, err := enabledTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &identityv1.SetUserRoleResponse{User: userInfo(user, mfa != nil)}, nil
+}
+
+func (s *Server) SetUserDisabled(ctx context.Context, req *identityv1.SetUserDisabledRequest) (*identityv1.SetUserDisabledResponse, error) {
+	user, err := adminTarget(ctx, req.ActorId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Disabled != (user.DisabledAt != nil) {
+		var disabledAt *time.Time
+		if req.Disabled {
+			now := time.Now()
+			disabledAt = &now
+		}
+		if err := database.DB.WithContext(ctx).Model(user).Update("disabled_at", disabledAt).Error; err != nil {
+			return nil, err
+		}
+		user.DisabledAt = disabledAt
+
+		event := "user_enabled"
+		if req.Disabled {
+			event = "user_disabled"
+			if _, err := revokeAllSessions(ctx, user.ID); err != nil {
+				logger.Log.Error("Failed to revoke sessions", zap.Error(err))
+			}
+		}
+		logger.Audit(event, zap.String("actor_id", req.ActorId), zap.Uint("user_id", user.ID))
+	}
+
+	mfa, err := enabledTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &identityv1.SetUserDisabledResponse{User: userInfo(user, mfa != nil)}, nil
+}
+
+func (s *Server) DeleteUser(ctx context.Context, req *identityv1.DeleteUserRequest) (*identityv1.DeleteUserResponse, error) {
+	user, err := adminTarget(ctx, req.ActorId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.DB.WithContext(ctx).Delete(user).Error; err != nil {
+		return nil, err
+	}
+	if _, err := revokeAllSessions(ctx, user.ID); err != nil {
+		logger.Log.Error("Failed to revoke sessions", zap.Error(err))
+	}
+
+	logger.Audit("user_deleted", zap.String("actor_id", req.ActorId), zap.Uint("user_id", user.ID))
+	return &identityv1.DeleteUserResponse{}, nil
+}
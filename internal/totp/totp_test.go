@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// The SHA-1 seed of RFC 6238 appendix B
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// RFC 6238 lists 8 digit codes, 6 digit codes are their last six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("T=%d: got %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+	code, err := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1)
+	if err != nil || code != "287082" {
+		t.Fatalf("got %q, %v", code, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// 1111111111 is step 37037037; 1111111109 is the step before
+	at := time.Unix(1111111111, 0)
+	now := Step(at)
+
+	cases := []struct {
+		name     string
+		code     string
+		at       time.Time
+		lastStep int64
+		want     int64
+		ok       bool
+	}{
+		{name: "current step", code: "050471", at: at, want: now, ok: true},
+		{name: "previous step", code: "081804", at: at, want: now - 1, ok: true},
+		{name: "next step", code: "050471", at: at.Add(-Period), want: now, ok: true},
+		{name: "two steps behind", code: "081804", at: at.Add(Period), ok: false},
+		{name: "two steps ahead", code: "050471", at: at.Add(-2 * Period), ok: false},
+		{name: "wrong code", code: "000000", at: at, ok: false},
+		{name: "too short", code: "50471", at: at, ok: false},
+		{name: "too long", code: "0050471", at: at, ok: false},
+		{name: "replayed", code: "050471", at: at, lastStep: now, ok: false},
+		{name: "older than last use", code: "081804", at: at, lastStep: now - 1, ok: false},
+		{name: "newer than last use", code: "050471", at: at, lastStep: now - 1, want: now, ok: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tc.code, tc.at, tc.lastStep)
+			if ok != tc.ok || (ok && step != tc.want) {
+				t.Fatalf("got step %d, %v; want %d, %v", step, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidSecret(t *testing.T) {
+	if _, ok := Validate("not base32!", "123456", time.Now(), 0); ok {
+		t.Fatal("accepted a code for an invalid secret")
+	}
+}
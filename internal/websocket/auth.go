@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/internal/middleware"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+
+	"go.uber.org/zap"
+)
+
+// authenticate reads the auth frame of a client that presented no token
+// during the handshake. The frame must arrive within authTimeout. On failure
+// the connection is closed with CloseUnauthorized.
+func (c *Client) authenticate() bool {
+	c.Conn.SetReadDeadline(time.Now().Add(c.Manager.opts.authTimeout))
+	_, data, err := c.Conn.ReadMessage()
+	if err != nil {
+		c.Disconnect(CloseUnauthorized, "authentication timeout")
+		return false
+	}
+
+	var msg protocol.Message
+	var payload protocol.AuthPayload
+	if c.codec.Unmarshal(data, &msg) != nil || msg.Type != protocol.TypeAuth ||
+		json.Unmarshal(msg.Payload, &payload) != nil || payload.Token == "" {
+		c.Disconnect(CloseUnauthorized, "authentication required")
+		return false
+	}
+
+	identity, err := middleware.ValidateToken(c.ctx, payload.Token)
+	if err != nil {
+		if !errors.Is(err, middleware.ErrInvalidToken) {
+			logger.Log.Error("Token validation failed", zap.Error(err))
+		}
+		c.Disconnect(CloseUnauthorized, "invalid token")
+		return false
+	}
+
+	c.UserID = identity.UserID
+	c.Username = identity.Username
+	c.Role = identity.Role
+	c.Permissions = identity.Permissions
+	c.SID = identity.SessionID
+	if !c.register() {
+		return false
+	}
+
+	b, _ := json.Marshal(protocol.SystemPayload{Event: "authenticated"})
+	c.sendJSON(protocol.Message{Type: protocol.TypeAuth, Payload: b})
+	return true
+}
@@ -3,45 +3,143 @@ package websocket
 import (
 	"context"
 	"encoding/json"
-	"io"
+	"sync"
 	"time"
 
 	"github.com/yeliheng/go-ai-gateway/api/gen/agent/v1"
 	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/internal/chat"
 	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
 
+// Application close codes (4000-4999 are reserved for applications).
 const (
-	// Time allowed to write a message to the peer.
-	writeWait = 10 * time.Second
-
-	// Time allowed to read the next pong message from the peer.
-	pongWait = 60 * time.Second
-
-	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
-
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512 * 1024
+	CloseUnauthorized    = 4001
+	CloseTokenRevoked    = 4003
+	CloseConnectionLimit = 4008
 )
 
 type Client struct {
 	Manager     *ClientManager
 	AgentClient agentv1.AgentServiceClient
 	Conn        *websocket.Conn
-	Send        chan []byte
 	ID          string
+
+	// codec encodes frames in the negotiated subprotocol, JSON by default
+	codec protocol.Codec
+
+	// Taken from the JWT claims and the upgrade request
+	UserID      string
+	Username    string
+	Role        string
+	Permissions model.Permissions
+	SID         string // Login session of the token
+	IP          string
+	ConnectedAt time.Time
+
+	// Push topics the client subscribed to, guarded by Manager.mu
+	topics map[string]bool
+
+	// Set once the client is authenticated and known to the manager
+	registered bool
+
+	// ctx lives as long as the connection; it is cancelled on unregister
+	// and every stream started by the client derives from it.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// out queues frames for WritePump without ever blocking the sender
+	out *outbox
+
+	// closeFrame is written to the peer when the connection is torn down.
+	closeMu    sync.Mutex
+	closeFrame []byte
+
+	// Request IDs of the streams the client follows after a resume
+	resumeMu sync.Mutex
+	resuming map[string]bool
+}
+
+func NewClient(manager *ClientManager, agentClient agentv1.AgentServiceClient, conn *websocket.Conn, id string) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		Manager:     manager,
+		AgentClient: agentClient,
+		Conn:        conn,
+		ID:          id,
+		codec:       protocol.CodecFor(conn.Subprotocol()),
+		ConnectedAt: time.Now(),
+		topics:      make(map[string]bool),
+		out:         newOutbox(manager.opts.maxBufferedBytes, manager.opts.slowClientTimeout),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Context returns the connection-scoped context.
+func (c *Client) Context() context.Context {
+	return c.ctx
+}
+
+// close cancels in-flight streams and stops WritePump. Safe to call more than once.
+func (c *Client) close() {
+	c.cancel()
+	c.out.close()
+}
+
+// Disconnect closes the connection with the given close code.
+func (c *Client) Disconnect(code int, reason string) {
+	c.closeMu.Lock()
+	if c.closeFrame == nil {
+		c.closeFrame = websocket.FormatCloseMessage(code, reason)
+	}
+	c.closeMu.Unlock()
+
+	// WritePump sends the close frame and closes the connection, which ends ReadPump
+	c.cancel()
+}
+
+func (c *Client) closeMessage() []byte {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	if c.closeFrame == nil {
+		return []byte{}
+	}
+	return c.closeFrame
+}
+
+// register adds the client to the cluster registry and the manager. It
+// returns false and closes the connection if the user has too many sockets.
+func (c *Client) register() bool {
+	if !c.Manager.Cluster.admitSession(c.ctx, c) {
+		logger.Log.Warn("User connection limit reached, rejecting client",
+			zap.String("id", c.ID), zap.String("user_id", c.UserID))
+		c.Disconnect(CloseConnectionLimit, "too many connections")
+		return false
+	}
+	c.registered = true
+	c.Manager.Register <- c
+	return true
 }
 
 func (c *Client) ReadPump() {
 	defer func() {
+		// Unregistering cancels the client, WritePump then sends the close frame and closes the connection
 		c.Manager.Unregister <- c
-		c.Conn.Close()
+		c.Manager.Cluster.removeSession(context.Background(), c)
+		c.Manager.releaseConn()
 	}()
-	c.Conn.SetReadLimit(maxMessageSize)
+	pongWait := c.Manager.opts.pongWait
+	c.Conn.SetReadLimit(c.Manager.opts.maxMessageSize)
+	// A client rejected at the handshake is already closing
+	if !c.registered && (c.ctx.Err() != nil || !c.authenticate()) {
+		return
+	}
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error { c.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
@@ -56,9 +154,9 @@ func (c *Client) ReadPump() {
 
 		// Parse standard protocol message
 		var msg protocol.Message
-		if err := json.Unmarshal(messageData, &msg); err != nil {
+		if err := c.codec.Unmarshal(messageData, &msg); err != nil {
 			logger.Log.Warn("Invalid message format", zap.Error(err))
-			c.sendError(400, "Invalid JSON format")
+			c.sendError("", 400, "Invalid message format")
 			continue
 		}
 
@@ -66,115 +164,116 @@ func (c *Client) ReadPump() {
 
 		switch msg.Type {
 		case protocol.TypeChat:
+			requestID := msg.RequestID
+			if requestID == "" {
+				requestID = uuid.New().String()
+			}
 			var payload protocol.ChatPayload
 			if err := json.Unmarshal(msg.Payload, &payload); err != nil {
-				c.sendError(400, "Invalid chat payload")
+				c.sendError(requestID, 400, "Invalid chat payload")
 				continue
 			}
-			c.handleChat(payload)
+			c.handleChat(requestID, payload)
+
+		case protocol.TypeResume:
+			var payload protocol.ResumePayload
+			if msg.RequestID == "" || json.Unmarshal(msg.Payload, &payload) != nil {
+				c.sendError(msg.RequestID, 400, "Invalid resume payload")
+				continue
+			}
+			c.handleResume(msg.RequestID, payload)
+
+		case protocol.TypeSubscribe, protocol.TypeUnsubscribe:
+			var payload protocol.TopicPayload
+			if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+				c.sendError(msg.RequestID, 400, "Invalid topic payload")
+				continue
+			}
+			if msg.Type == protocol.TypeUnsubscribe {
+				c.Manager.Unsubscribe(c, payload.Topic)
+				continue
+			}
+			if err := c.Manager.Subscribe(c, payload.Topic); err != nil {
+				c.sendError(msg.RequestID, 400, err.Error())
+			}
 
 		case protocol.TypePing:
 			c.sendJSON(protocol.Message{Type: protocol.TypePong})
 
 		default:
-			c.sendError(404, "Unknown message type")
+			c.sendError(msg.RequestID, 404, "Unknown message type")
 		}
 	}
 }
 
-func (c *Client) handleChat(payload protocol.ChatPayload) {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	stream, err := c.AgentClient.ChatStream(ctx, &agentv1.ChatRequest{
-		Model:   payload.Model,
-		Content: payload.Content,
-	})
+func (c *Client) handleChat(requestID string, payload protocol.ChatPayload) {
+	if !c.Manager.startStream() {
+		c.sendError(requestID, 503, "Server is shutting down")
+		return
+	}
 
-	if err != nil {
-		c.sendError(500, err.Error())
-		cancel()
+	cs, ok := c.newChatStream(requestID)
+	if !ok {
+		c.Manager.streams.Done()
+		c.sendError(requestID, 409, "Duplicate request_id")
 		return
 	}
 
+	ctx, cancel := cs.context()
+	c.Manager.trackStream(cs)
+
 	go func() {
+		defer c.Manager.streams.Done()
+		defer c.Manager.untrackStream(cs)
 		defer cancel()
-		for {
-			resp, err := stream.Recv()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				logger.Log.Error("Stream error", zap.Error(err))
-				c.sendError(500, "Stream interrupted")
-				break
-			}
-
-			respPayload := protocol.ChatPayload{
-				Content: resp.Content,
-				Type:    resp.Type,
-				Model:   payload.Model,
-			}
-			payloadBytes, _ := json.Marshal(respPayload)
-
-			respMsg := protocol.Message{
-				Type:    protocol.TypeChat,
-				Payload: payloadBytes,
-			}
-
-			c.sendJSON(respMsg)
-		}
+		chat.Stream(ctx, c.AgentClient, requestID, payload, c.Permissions, cs)
 	}()
 }
 
+// sendJSON queues msg for the client. It never blocks; a client that can't
+// keep up is disconnected and expected to resume its streams.
 func (c *Client) sendJSON(msg protocol.Message) {
-	data, err := json.Marshal(msg)
+	if c.out.push(msg) {
+		return
+	}
+	if c.ctx.Err() == nil {
+		slowDisconnects.Add(1)
+		logger.Log.Warn("Disconnecting slow client", zap.String("id", c.ID))
+		c.Disconnect(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+func (c *Client) sendPayload(msgType protocol.MessageType, requestID string, payload any) {
+	b, err := json.Marshal(payload)
 	if err != nil {
-		logger.Log.Error("Failed to marshal message", zap.Error(err))
+		logger.Log.Error("Failed to marshal payload", zap.Error(err))
 		return
 	}
-	c.Send <- data
+	c.sendJSON(protocol.Message{
+		Type:      msgType,
+		RequestID: requestID,
+		Payload:   b,
+	})
 }
 
-func (c *Client) sendError(code int, message string) {
-	payload := protocol.ErrorPayload{
+func (c *Client) sendError(requestID string, code int, message string) {
+	c.sendPayload(protocol.TypeError, requestID, protocol.ErrorPayload{
 		Code:    code,
 		Message: message,
-	}
-	b, _ := json.Marshal(payload)
-	c.sendJSON(protocol.Message{
-		Type:    protocol.TypeError,
-		Payload: b,
 	})
 }
 
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	writeWait := c.Manager.opts.writeWait
+	ticker := time.NewTicker(c.Manager.opts.pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
 	}()
 	for {
 		select {
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued messages to the current websocket message.
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.Send)
-			}
-
-			if err := w.Close(); err != nil {
+		case <-c.out.notify:
+			if err := c.writeFrames(c.out.drain()); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -182,6 +281,31 @@ func (c *Client) WritePump() {
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+		case <-c.ctx.Done():
+			// Flush what is left, e.g. a final system frame, before closing
+			c.writeFrames(c.out.drain())
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.WriteMessage(websocket.CloseMessage, c.closeMessage())
+			return
+		}
+	}
+}
+
+func (c *Client) writeFrames(msgs []protocol.Message) error {
+	frameType := websocket.TextMessage
+	if c.codec.Binary() {
+		frameType = websocket.BinaryMessage
+	}
+	for _, msg := range msgs {
+		data, err := c.codec.Marshal(msg)
+		if err != nil {
+			logger.Log.Error("Failed to marshal message", zap.Error(err))
+			continue
+		}
+		c.Conn.SetWriteDeadline(time.Now().Add(c.Manager.opts.writeWait))
+		if err := c.Conn.WriteMessage(frameType, data); err != nil {
+			return err
 		}
 	}
+	return nil
 }
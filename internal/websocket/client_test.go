@@ -0,0 +1,371 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/internal/cache"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = zap.NewNop()
+	// Nothing listens there, Redis calls fail fast
+	cache.RDB = redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	os.Exit(m.Run())
+}
+
+func newTestManager(opts options) *ClientManager {
+	manager := &ClientManager{
+		Clients:   make(map[*Client]bool),
+		sessions:  make(map[string]*Client),
+		users:     make(map[string]map[*Client]bool),
+		sids:      make(map[string]map[*Client]bool),
+		ips:       make(map[string]map[*Client]bool),
+		topics:    make(map[string]map[*Client]bool),
+		resumable: make(map[string]*chatStream),
+		opts:      opts,
+	}
+	manager.upgrader = newUpgrader(manager.opts)
+	manager.Cluster = newCluster("test", manager)
+	return manager
+}
+
+// newTestClient returns a client without a connection, enough for everything
+// but the pumps.
+func newTestClient(manager *ClientManager, id string) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		Manager:     manager,
+		ID:          id,
+		codec:       protocol.CodecFor(""),
+		ConnectedAt: time.Now(),
+		topics:      make(map[string]bool),
+		out:         newOutbox(manager.opts.maxBufferedBytes, manager.opts.slowClientTimeout),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// dialTestClient connects a client over a real socket and returns the
+// server side client and the peer connection.
+func dialTestClient(t *testing.T, manager *ClientManager) (*Client, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *Client, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := manager.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		accepted <- NewClient(manager, nil, conn, "server")
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { peer.Close() })
+	return <-accepted, peer
+}
+
+func testOptions() options {
+	return loadOptions(config.WebSocketConfig{})
+}
+
+func ping() protocol.Message {
+	return protocol.Message{Type: protocol.TypePong}
+}
+
+func TestSendAfterClose(t *testing.T) {
+	manager := newTestManager(testOptions())
+	client := newTestClient(manager, "a")
+
+	client.close()
+	client.close()
+	for range 10 {
+		client.sendJSON(ping())
+	}
+
+	if client.ctx.Err() == nil {
+		t.Fatal("client context not cancelled")
+	}
+	if msgs := client.out.drain(); len(msgs) != 0 {
+		t.Fatalf("closed outbox queued %d frames", len(msgs))
+	}
+}
+
+func TestConcurrentSendAndClose(t *testing.T) {
+	manager := newTestManager(testOptions())
+	client := newTestClient(manager, "a")
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 200 {
+				client.sendJSON(ping())
+				client.sendPayload(protocol.TypeChat, "req", protocol.ChatPayload{Type: "text", Content: "x"})
+			}
+		})
+	}
+	wg.Go(func() { client.out.drain() })
+	wg.Go(func() { client.Disconnect(websocket.CloseNormalClosure, "bye") })
+	wg.Go(client.close)
+	wg.Wait()
+
+	client.sendJSON(ping())
+	if msgs := client.out.drain(); len(msgs) != 0 {
+		t.Fatalf("closed outbox queued %d frames", len(msgs))
+	}
+}
+
+func TestConcurrentUnregister(t *testing.T) {
+	manager := newTestManager(testOptions())
+
+	var clients []*Client
+	for i := range 20 {
+		client := newTestClient(manager, fmt.Sprintf("c%d", i))
+		client.UserID = "u1"
+		client.IP = "10.0.0.1"
+		manager.addClient(client)
+		clients = append(clients, client)
+	}
+
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Go(func() {
+			for range 50 {
+				client.sendJSON(ping())
+			}
+		})
+		wg.Go(func() { manager.Subscribe(client, "news") })
+		wg.Go(func() { manager.removeClient(client) })
+		// Unregistering twice, e.g. after an eviction, must be harmless
+		wg.Go(func() { manager.removeClient(client) })
+	}
+	wg.Go(func() {
+		manager.deliverLocal(Envelope{Target: TargetTopic, ID: "news", Message: &protocol.Message{Type: protocol.TypeSystem}})
+	})
+	wg.Go(func() {
+		manager.deliverLocal(Envelope{Target: TargetUser, ID: "u1", Close: &CloseCommand{Code: CloseTokenRevoked}})
+	})
+	wg.Wait()
+
+	for _, client := range clients {
+		if client.ctx.Err() == nil {
+			t.Fatalf("client %s still running after unregister", client.ID)
+		}
+	}
+	// Subscribe may have raced ahead of the removal, but never after it
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	if len(manager.Clients) != 0 || len(manager.users) != 0 || len(manager.ips) != 0 || len(manager.topics) != 0 {
+		t.Fatalf("indexes not empty: %d clients, %d users, %d ips, %d topics",
+			len(manager.Clients), len(manager.users), len(manager.ips), len(manager.topics))
+	}
+}
+
+func TestStreamContextCancelledOnUnregister(t *testing.T) {
+	opts := testOptions()
+	opts.resumeTTL = 0
+	manager := newTestManager(opts)
+	client := newTestClient(manager, "a")
+	manager.addClient(client)
+
+	cs, _ := client.newChatStream("r1")
+	ctx, cancel := cs.context()
+	defer cancel()
+	manager.removeClient(client)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stream not cancelled on unregister")
+	}
+}
+
+// bufferedStream returns a resumable stream without claiming it in Redis.
+func bufferedStream(client *Client, requestID string) *chatStream {
+	return &chatStream{client: client, owner: client.owner(), requestID: requestID, buffered: true}
+}
+
+func TestStreamContextOutlivesClientForGrace(t *testing.T) {
+	opts := testOptions()
+	opts.resumeGrace = 50 * time.Millisecond
+	manager := newTestManager(opts)
+	client := newTestClient(manager, "a")
+
+	ctx, cancel := bufferedStream(client, "r1").context()
+	defer cancel()
+	client.close()
+
+	if ctx.Err() != nil {
+		t.Fatal("stream cancelled before the resume grace period")
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stream not cancelled after the resume grace period")
+	}
+}
+
+func TestResumeStopsGraceTimer(t *testing.T) {
+	opts := testOptions()
+	opts.resumeGrace = 50 * time.Millisecond
+	manager := newTestManager(opts)
+	client := newTestClient(manager, "a")
+	client.UserID = "u1"
+
+	cs := bufferedStream(client, "r1")
+	ctx, cancel := cs.context()
+	defer cancel()
+	manager.trackStream(cs)
+
+	client.close()
+	time.Sleep(10 * time.Millisecond)
+	manager.attachStream("user:u1", "r1")
+
+	time.Sleep(4 * opts.resumeGrace)
+	if ctx.Err() != nil {
+		t.Fatal("resumed stream cancelled by the grace timer")
+	}
+
+	manager.untrackStream(cs)
+	if len(manager.resumable) != 0 {
+		t.Fatal("stream still tracked after it ended")
+	}
+}
+
+func TestWritePumpConcurrentDisconnect(t *testing.T) {
+	manager := newTestManager(testOptions())
+	client, peer := dialTestClient(t, manager)
+
+	pumpDone := make(chan struct{})
+	go func() {
+		client.WritePump()
+		close(pumpDone)
+	}()
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			for range 100 {
+				client.sendJSON(ping())
+			}
+		})
+	}
+	wg.Go(func() { client.Disconnect(CloseTokenRevoked, "token revoked") })
+	wg.Wait()
+	manager.removeClient(client)
+
+	select {
+	case <-pumpDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("WritePump did not stop")
+	}
+
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := peer.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, CloseTokenRevoked) {
+			t.Fatalf("expected close %d, got %v", CloseTokenRevoked, err)
+		}
+		break
+	}
+}
+
+func TestMaxConnsCountsPendingSockets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	opts := testOptions()
+	opts.maxConns = 2
+	manager := newTestManager(opts)
+	manager.Unregister = make(chan *Client)
+	go func() {
+		for client := range manager.Unregister {
+			manager.removeClient(client)
+		}
+	}()
+
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) {
+		c.Set("authPending", true)
+		ServeWs(manager, nil, c)
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	// Neither socket sends its auth frame, both hold a slot
+	var peers []*websocket.Conn
+	for range 2 {
+		peer, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("dial below the limit: %v", err)
+		}
+		defer peer.Close()
+		peers = append(peers, peer)
+	}
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("dial above the limit: want 503, got %v", err)
+	}
+
+	peers[0].Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for manager.conns.Load() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("slot of a closed socket not released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	peer, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial after release: %v", err)
+	}
+	peer.Close()
+}
+
+func TestStartStreamDuringShutdown(t *testing.T) {
+	manager := newTestManager(testOptions())
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 200 {
+				if manager.startStream() {
+					manager.streams.Done()
+				}
+			}
+		})
+	}
+	wg.Go(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := manager.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+	})
+	wg.Wait()
+
+	if manager.startStream() {
+		t.Fatal("stream started after shutdown")
+	}
+}
@@ -0,0 +1,270 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/internal/cache"
+	"github.com/yeliheng/go-ai-gateway/internal/middleware"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Redis layout of the cluster session registry and message bus:
+//
+//	ws:node:<node>        alive marker of a biz replica, refreshed by heartbeat
+//	ws:user:<user>        hash session ID -> "<node>|<connected at, unix ms>"
+//	ws:bus:all            channel every node subscribes to
+//	ws:bus:node:<node>    channel for messages routed to one node
+//
+// Token revocations published by the identity service arrive on
+// cache.RevocationChannel.
+const (
+	nodeHeartbeat = 10 * time.Second
+	nodeTTL       = 3 * nodeHeartbeat
+
+	busAllChannel = "ws:bus:all"
+)
+
+// Admits a session into a user's registry, enforcing the per-user limit
+// across the cluster. Sessions of dead nodes are dropped first. Returns the
+// evicted session IDs, or nil if the limit is reached and eviction is off.
+//
+// KEYS[1] user sessions, ARGV: session ID, entry, limit, evict (0/1), node key prefix
+const admitUserSession = `
+local entries = redis.call('HGETALL', KEYS[1])
+local live = {}
+for i = 1, #entries, 2 do
+	local node, at = string.match(entries[i + 1], '^(.*)|(%d+)$')
+	if not node then
+		node, at = entries[i + 1], 0
+	end
+	if redis.call('EXISTS', ARGV[5] .. node) == 1 then
+		table.insert(live, {id = entries[i], at = tonumber(at)})
+	else
+		redis.call('HDEL', KEYS[1], entries[i])
+	end
+end
+local limit = tonumber(ARGV[3])
+local evicted = {}
+if limit > 0 and #live >= limit then
+	if ARGV[4] ~= '1' then
+		return nil
+	end
+	table.sort(live, function(a, b) return a.at < b.at end)
+	for i = 1, #live - limit + 1 do
+		redis.call('HDEL', KEYS[1], live[i].id)
+		table.insert(evicted, live[i].id)
+	end
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return evicted
+`
+
+func nodeKey(nodeID string) string {
+	return "ws:node:" + nodeID
+}
+
+func userSessionsKey(userID string) string {
+	return "ws:user:" + userID
+}
+
+func nodeChannel(nodeID string) string {
+	return "ws:bus:node:" + nodeID
+}
+
+type TargetKind string
+
+const (
+	TargetAll     TargetKind = "all"
+	TargetUser    TargetKind = "user"
+	TargetSession TargetKind = "session"
+	TargetTopic   TargetKind = "topic"
+)
+
+// Envelope is a server-initiated message travelling over the bus. It either
+// carries a protocol message to deliver, or a close command.
+type Envelope struct {
+	Target  TargetKind        `json:"target"`
+	ID      string            `json:"id,omitempty"` // user ID, session ID or topic
+	Message *protocol.Message `json:"message,omitempty"`
+	Close   *CloseCommand     `json:"close,omitempty"`
+}
+
+// CloseCommand closes the targeted sockets with a WebSocket close code.
+type CloseCommand struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// Cluster makes a ClientManager aware of the sockets held by other replicas.
+type Cluster struct {
+	NodeID  string
+	manager *ClientManager
+}
+
+func newCluster(nodeID string, manager *ClientManager) *Cluster {
+	if nodeID == "" {
+		host, _ := os.Hostname()
+		nodeID = fmt.Sprintf("%s-%s", host, uuid.New().String()[:8])
+	}
+	return &Cluster{
+		NodeID:  nodeID,
+		manager: manager,
+	}
+}
+
+func (cl *Cluster) run() {
+	ctx := context.Background()
+
+	go cl.heartbeat(ctx)
+
+	sub := cache.RDB.Subscribe(ctx, busAllChannel, nodeChannel(cl.NodeID), cache.RevocationChannel)
+	defer sub.Close()
+
+	logger.Log.Info("Joined WebSocket cluster", zap.String("node_id", cl.NodeID))
+	for msg := range sub.Channel() {
+		if msg.Channel == cache.RevocationChannel {
+			var rev cache.Revocation
+			if err := json.Unmarshal([]byte(msg.Payload), &rev); err != nil {
+				logger.Log.Warn("Invalid revocation", zap.Error(err))
+				continue
+			}
+			middleware.ForgetRevoked(rev.UserID, rev.SessionID)
+			cl.manager.revokeLocal(rev)
+			continue
+		}
+
+		var env Envelope
+		if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+			logger.Log.Warn("Invalid bus envelope", zap.Error(err))
+			continue
+		}
+		cl.manager.deliverLocal(env)
+	}
+}
+
+func (cl *Cluster) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(nodeHeartbeat)
+	defer ticker.Stop()
+	for {
+		if err := cache.RDB.Set(ctx, nodeKey(cl.NodeID), time.Now().Unix(), nodeTTL).Err(); err != nil {
+			logger.Log.Error("Cluster heartbeat failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// admitSession records that this node holds the client's socket, unless
+// the user already has maxConnsPerUser sockets in the cluster. With
+// evict_oldest the user's oldest sockets are closed instead, wherever they
+// are. Registry failures don't block the client; the per-replica limit still
+// applies then.
+func (cl *Cluster) admitSession(ctx context.Context, c *Client) bool {
+	if c.UserID == "" {
+		return true
+	}
+
+	opts := cl.manager.opts
+	evict := "0"
+	if opts.evictOldest {
+		evict = "1"
+	}
+	entry := fmt.Sprintf("%s|%d", cl.NodeID, c.ConnectedAt.UnixMilli())
+	evicted, err := cache.RDB.Eval(ctx, admitUserSession, []string{userSessionsKey(c.UserID)},
+		c.ID, entry, opts.maxConnsPerUser, evict, nodeKey("")).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return false
+	}
+	if err != nil {
+		logger.Log.Error("Failed to register session", zap.String("id", c.ID), zap.Error(err))
+		return true
+	}
+
+	for _, sessionID := range evicted {
+		env := Envelope{Target: TargetSession, ID: sessionID, Close: &CloseCommand{
+			Code:   CloseConnectionLimit,
+			Reason: "evicted by a newer session",
+		}}
+		if err := cl.publish(ctx, env); err != nil {
+			logger.Log.Error("Failed to evict session", zap.String("id", sessionID), zap.Error(err))
+		}
+	}
+	return true
+}
+
+func (cl *Cluster) removeSession(ctx context.Context, c *Client) {
+	if c.UserID == "" {
+		return
+	}
+	if err := cache.RDB.HDel(ctx, userSessionsKey(c.UserID), c.ID).Err(); err != nil {
+		logger.Log.Error("Failed to unregister session", zap.String("id", c.ID), zap.Error(err))
+	}
+}
+
+// userNodes returns the live nodes holding sockets of a user. Sessions left
+// behind by dead nodes are removed on the way.
+func (cl *Cluster) userNodes(ctx context.Context, userID string) ([]string, error) {
+	sessions, err := cache.RDB.HGetAll(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	alive := make(map[string]bool)
+	var nodes []string
+	for sessionID, entry := range sessions {
+		nodeID, _, _ := strings.Cut(entry, "|")
+		live, checked := alive[nodeID]
+		if !checked {
+			n, err := cache.RDB.Exists(ctx, nodeKey(nodeID)).Result()
+			if err != nil {
+				return nil, err
+			}
+			live = n > 0
+			alive[nodeID] = live
+			if live {
+				nodes = append(nodes, nodeID)
+			}
+		}
+		if !live {
+			cache.RDB.HDel(ctx, userSessionsKey(userID), sessionID)
+		}
+	}
+	return nodes, nil
+}
+
+// publish routes an envelope to the nodes that may hold its target.
+func (cl *Cluster) publish(ctx context.Context, env Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	if env.Target != TargetUser {
+		return cache.RDB.Publish(ctx, busAllChannel, data).Err()
+	}
+
+	nodes, err := cl.userNodes(ctx, env.ID)
+	if err != nil {
+		return err
+	}
+	for _, nodeID := range nodes {
+		if err := cache.RDB.Publish(ctx, nodeChannel(nodeID), data).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,9 +2,14 @@ package websocket
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/yeliheng/go-ai-gateway/api/gen/agent/v1"
 	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/common/model"
+	"github.com/yeliheng/go-ai-gateway/internal/middleware"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -12,32 +17,106 @@ import (
 	"go.uber.org/zap"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	// Solve cross-domain problems
-	CheckOrigin: func(r *http.Request) bool {
+func newUpgrader(opts options) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:  opts.readBufferSize,
+		WriteBufferSize: opts.writeBufferSize,
+		// Negotiates permessage-deflate with clients that offer it
+		EnableCompression: opts.enableCompression,
+		Subprotocols:      subprotocols(),
+		CheckOrigin:       originChecker(opts.allowedOrigins),
+	}
+}
+
+// subprotocols lists the codecs by preference, then the token marker which is
+// selected when the token is the only thing passed as a subprotocol (the
+// token itself is never echoed back).
+func subprotocols() []string {
+	var names []string
+	for _, codec := range protocol.Codecs {
+		names = append(names, codec.Name())
+	}
+	return append(names, middleware.TokenSubprotocol)
+}
+
+// originChecker allows the configured origins. Requests without an Origin
+// header (non-browser clients) are always allowed.
+func originChecker(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if len(allowed) == 0 {
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		}
+		for _, pattern := range allowed {
+			if matchOrigin(pattern, origin) {
+				return true
+			}
+		}
+		logger.Log.Warn("Rejected WebSocket origin", zap.String("origin", origin))
+		return false
+	}
+}
+
+// matchOrigin matches "*", an exact origin, or a "scheme://*.domain" wildcard.
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" || strings.EqualFold(pattern, origin) {
 		return true
-	},
+	}
+	scheme, host, ok := strings.Cut(pattern, "://*.")
+	if !ok {
+		return false
+	}
+	prefix := scheme + "://"
+	if len(origin) <= len(prefix) || !strings.EqualFold(origin[:len(prefix)], prefix) {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(origin[len(prefix):]), "."+strings.ToLower(host))
 }
 
 func ServeWs(manager *ClientManager, agentClient agentv1.AgentServiceClient, c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if manager.Draining() {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down"})
+		return
+	}
+
+	// Released by ReadPump once the socket is gone
+	if !manager.acquireConn() {
+		logger.Log.Warn("Connection limit reached, rejecting upgrade", zap.String("ip", c.ClientIP()))
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Too many connections"})
+		return
+	}
+
+	conn, err := manager.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
+		manager.releaseConn()
 		logger.Log.Error("Failed to upgrade to websocket", zap.Error(err))
 		return
 	}
+	if manager.opts.enableCompression {
+		if err := conn.SetCompressionLevel(manager.opts.compressionLevel); err != nil {
+			logger.Log.Warn("Invalid compression level", zap.Error(err))
+		}
+	}
 
 	sessionID := uuid.New().String()
-	client := &Client{
-		Manager:     manager,
-		AgentClient: agentClient,
-		Conn:        conn,
-		Send:        make(chan []byte, 256),
-		ID:          sessionID,
+	client := NewClient(manager, agentClient, conn, sessionID)
+	client.UserID = c.GetString("userID")
+	client.Username = c.GetString("username")
+	client.Role = c.GetString("role")
+	if perms, ok := c.Get("permissions"); ok {
+		client.Permissions, _ = perms.(model.Permissions)
 	}
+	client.SID = c.GetString("sid")
+	client.IP = c.ClientIP()
 
-	client.Manager.Register <- client
+	// Clients without a handshake token register once their auth frame is accepted
+	if !c.GetBool("authPending") {
+		client.register()
+	}
 
 	go client.WritePump()
 	go client.ReadPump()
@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	cases := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"*", "https://anything.test", true},
+
+		// Exact
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "HTTPS://App.Example.com", true},
+		{"https://app.example.com", "http://app.example.com", false},
+		{"https://app.example.com", "https://app.example.com.evil.test", false},
+		{"https://app.example.com", "https://example.com", false},
+
+		// Wildcard
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://APP.Example.COM", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://example.com.evil.test", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://", false},
+
+		// Ports
+		{"http://localhost:8080", "http://localhost:8080", true},
+		{"http://localhost:8080", "http://localhost:8081", false},
+		{"http://localhost:8080", "http://localhost", false},
+		{"http://localhost", "http://localhost:8080", false},
+		{"https://*.example.com", "https://app.example.com:8443", false},
+		{"https://*.example.com:8443", "https://app.example.com:8443", true},
+		{"https://*.example.com:8443", "https://app.example.com", false},
+		{"https://*.example.com:8443", "https://app.example.com:9443", false},
+	}
+	for _, tc := range cases {
+		if got := matchOrigin(tc.pattern, tc.origin); got != tc.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tc.pattern, tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestOriginChecker(t *testing.T) {
+	cases := []struct {
+		name    string
+		allowed []string
+		host    string
+		origin  string
+		want    bool
+	}{
+		{"no origin header", []string{"https://app.example.com"}, "gw.example.com", "", true},
+		{"listed", []string{"https://other.test", "https://app.example.com"}, "gw.example.com", "https://app.example.com", true},
+		{"not listed", []string{"https://app.example.com"}, "gw.example.com", "https://evil.test", false},
+		{"same origin by default", nil, "gw.example.com:8080", "http://gw.example.com:8080", true},
+		{"other port by default", nil, "gw.example.com:8080", "http://gw.example.com:9090", false},
+		{"other host by default", nil, "gw.example.com", "https://evil.test", false},
+		{"malformed origin", nil, "gw.example.com", "://gw.example.com", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws", nil)
+			r.Host = tc.host
+			if tc.origin != "" {
+				r.Header.Set("Origin", tc.origin)
+			}
+			if got := originChecker(tc.allowed)(r); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
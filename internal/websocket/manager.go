@@ -1,49 +1,401 @@
 package websocket
 
 import (
-	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"context"
+	"encoding/json"
+	"errors"
 	"sync"
+	"sync/atomic"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/internal/cache"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
 
+	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
 
+const (
+	maxTopicLength     = 128
+	maxTopicsPerClient = 32
+)
+
+var (
+	ErrInvalidTopic  = errors.New("invalid topic")
+	ErrTooManyTopics = errors.New("too many topic subscriptions")
+)
+
 type ClientManager struct {
-	Clients    map[*Client]bool
-	Broadcast  chan []byte
+	Clients map[*Client]bool
+	// Broadcast delivers a message to every socket of this node. Use
+	// BroadcastAll to reach the whole cluster.
+	Broadcast  chan protocol.Message
 	Register   chan *Client
 	Unregister chan *Client
 	mu         sync.RWMutex
+
+	// Indexes over Clients, guarded by mu
+	sessions map[string]*Client
+	users    map[string]map[*Client]bool
+	sids     map[string]map[*Client]bool
+	ips      map[string]map[*Client]bool
+	topics   map[string]map[*Client]bool
+
+	// Buffered streams produced on this node, by owner and request ID
+	resumable map[string]*chatStream
+
+	Cluster *Cluster
+
+	// Set once Shutdown starts; new sockets and chats are refused.
+	// drainMu orders it against streams being started.
+	drainMu  sync.Mutex
+	draining atomic.Bool
+	// In-flight chat streams
+	streams sync.WaitGroup
+
+	// Open sockets, authenticated or not
+	conns atomic.Int64
+
+	opts     options
+	upgrader websocket.Upgrader
 }
 
 func NewClientManager() *ClientManager {
-	return &ClientManager{
-		Broadcast:  make(chan []byte),
+	cfg := config.GlobalConfig.WebSocket
+	manager := &ClientManager{
+		Broadcast:  make(chan protocol.Message),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
 		Clients:    make(map[*Client]bool),
+		sessions:   make(map[string]*Client),
+		users:      make(map[string]map[*Client]bool),
+		sids:       make(map[string]map[*Client]bool),
+		ips:        make(map[string]map[*Client]bool),
+		topics:     make(map[string]map[*Client]bool),
+		resumable:  make(map[string]*chatStream),
+		opts:       loadOptions(cfg),
 	}
+	manager.upgrader = newUpgrader(manager.opts)
+	manager.Cluster = newCluster(cfg.NodeID, manager)
+	return manager
 }
 
 func (manager *ClientManager) Run() {
+	go manager.Cluster.run()
+
 	for {
 		select {
 		case client := <-manager.Register:
-			manager.mu.Lock()
-			manager.Clients[client] = true
-			manager.mu.Unlock()
-			logger.Log.Info("Client registered", zap.String("id", client.ID))
+			manager.addClient(client)
 
 		case client := <-manager.Unregister:
-			manager.mu.Lock()
-			if _, ok := manager.Clients[client]; ok {
-				delete(manager.Clients, client)
-				close(client.Send)
-				logger.Log.Info("Client unregistered", zap.String("id", client.ID))
-			}
-			manager.mu.Unlock()
+			manager.removeClient(client)
 
 		case message := <-manager.Broadcast:
-			logger.Log.Debug("Broadcast message received", zap.String("msg", string(message)))
+			manager.deliverLocal(Envelope{Target: TargetAll, Message: &message})
 		}
 	}
 }
+
+// addClient admits a client and adds it to the indexes, or disconnects it if
+// a connection limit is reached.
+func (manager *ClientManager) addClient(client *Client) {
+	manager.mu.Lock()
+	if !manager.admit(client) {
+		manager.mu.Unlock()
+		logger.Log.Warn("Connection limit reached, rejecting client",
+			zap.String("id", client.ID), zap.String("user_id", client.UserID), zap.String("ip", client.IP))
+		client.Disconnect(CloseConnectionLimit, "too many connections")
+		return
+	}
+	manager.Clients[client] = true
+	manager.sessions[client.ID] = client
+	addToIndex(manager.users, client.UserID, client)
+	addToIndex(manager.sids, client.SID, client)
+	addToIndex(manager.ips, client.IP, client)
+	manager.mu.Unlock()
+	logger.Log.Info("Client registered", zap.String("id", client.ID), zap.String("user_id", client.UserID))
+}
+
+// removeClient drops a client and cancels its streams.
+func (manager *ClientManager) removeClient(client *Client) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if _, ok := manager.Clients[client]; ok {
+		manager.removeLocked(client)
+		logger.Log.Info("Client unregistered", zap.String("id", client.ID))
+	}
+	// Also covers clients rejected by admit
+	client.close()
+}
+
+// acquireConn reserves a slot for a new socket under the maxConns limit.
+func (manager *ClientManager) acquireConn() bool {
+	limit := int64(manager.opts.maxConns)
+	if n := manager.conns.Add(1); limit > 0 && n > limit {
+		manager.conns.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (manager *ClientManager) releaseConn() {
+	manager.conns.Add(-1)
+}
+
+// removeLocked drops a client from the manager. Must be called with mu held.
+func (manager *ClientManager) removeLocked(client *Client) {
+	delete(manager.Clients, client)
+	delete(manager.sessions, client.ID)
+	removeFromIndex(manager.users, client.UserID, client)
+	removeFromIndex(manager.sids, client.SID, client)
+	removeFromIndex(manager.ips, client.IP, client)
+	for topic := range client.topics {
+		removeFromIndex(manager.topics, topic, client)
+	}
+}
+
+// admit enforces the per-user and per-IP connection limits for a new client,
+// evicting the oldest sockets if configured to. Must be called with mu held.
+func (manager *ClientManager) admit(client *Client) bool {
+	checks := []struct {
+		clients map[*Client]bool
+		max     int
+	}{
+		{manager.users[client.UserID], manager.opts.maxConnsPerUser},
+		{manager.ips[client.IP], manager.opts.maxConnsPerIP},
+	}
+
+	for _, check := range checks {
+		if check.max <= 0 || len(check.clients) < check.max {
+			continue
+		}
+		if !manager.opts.evictOldest {
+			return false
+		}
+	}
+
+	for _, check := range checks {
+		if check.max <= 0 {
+			continue
+		}
+		for excess := len(check.clients) - check.max + 1; excess > 0; excess-- {
+			oldest := oldestClient(check.clients)
+			if oldest == nil {
+				break
+			}
+			// Drop it from the indexes now, the socket closes asynchronously
+			manager.removeLocked(oldest)
+			oldest.Disconnect(CloseConnectionLimit, "evicted by a newer session")
+		}
+	}
+	return true
+}
+
+func oldestClient(clients map[*Client]bool) *Client {
+	var oldest *Client
+	for client := range clients {
+		if oldest == nil || client.ConnectedAt.Before(oldest.ConnectedAt) {
+			oldest = client
+		}
+	}
+	return oldest
+}
+
+func addToIndex(index map[string]map[*Client]bool, key string, client *Client) {
+	if key == "" {
+		return
+	}
+	if index[key] == nil {
+		index[key] = make(map[*Client]bool)
+	}
+	index[key][client] = true
+}
+
+func removeFromIndex(index map[string]map[*Client]bool, key string, client *Client) {
+	clients := index[key]
+	if clients == nil {
+		return
+	}
+	delete(clients, client)
+	if len(clients) == 0 {
+		delete(index, key)
+	}
+}
+
+// Subscribe adds the client to a push topic.
+func (manager *ClientManager) Subscribe(client *Client, topic string) error {
+	if topic == "" || len(topic) > maxTopicLength {
+		return ErrInvalidTopic
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if _, ok := manager.Clients[client]; !ok {
+		return nil
+	}
+	if client.topics[topic] {
+		return nil
+	}
+	if len(client.topics) >= maxTopicsPerClient {
+		return ErrTooManyTopics
+	}
+	client.topics[topic] = true
+	if manager.topics[topic] == nil {
+		manager.topics[topic] = make(map[*Client]bool)
+	}
+	manager.topics[topic][client] = true
+	return nil
+}
+
+// Unsubscribe removes the client from a push topic.
+func (manager *ClientManager) Unsubscribe(client *Client, topic string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	delete(client.topics, topic)
+	removeFromIndex(manager.topics, topic, client)
+}
+
+// Dispatch delivers a server-initiated message or close command to its
+// target, wherever in the cluster the sockets are.
+func (manager *ClientManager) Dispatch(ctx context.Context, env Envelope) error {
+	return manager.Cluster.publish(ctx, env)
+}
+
+// BroadcastAll delivers msg to every socket in the cluster.
+func (manager *ClientManager) BroadcastAll(ctx context.Context, msg protocol.Message) error {
+	return manager.Dispatch(ctx, Envelope{Target: TargetAll, Message: &msg})
+}
+
+// SendToSession delivers msg to a single socket.
+func (manager *ClientManager) SendToSession(ctx context.Context, sessionID string, msg protocol.Message) error {
+	return manager.Dispatch(ctx, Envelope{Target: TargetSession, ID: sessionID, Message: &msg})
+}
+
+// PublishTopic delivers msg to every socket subscribed to topic.
+func (manager *ClientManager) PublishTopic(ctx context.Context, topic string, msg protocol.Message) error {
+	return manager.Dispatch(ctx, Envelope{Target: TargetTopic, ID: topic, Message: &msg})
+}
+
+// SendToUser delivers msg to every socket of a user.
+func (manager *ClientManager) SendToUser(ctx context.Context, userID string, msg protocol.Message) error {
+	return manager.Dispatch(ctx, Envelope{Target: TargetUser, ID: userID, Message: &msg})
+}
+
+// DisconnectUser closes every socket of a user, e.g. on forced logout.
+func (manager *ClientManager) DisconnectUser(ctx context.Context, userID string, code int, reason string) error {
+	return manager.Dispatch(ctx, Envelope{Target: TargetUser, ID: userID, Close: &CloseCommand{Code: code, Reason: reason}})
+}
+
+// deliverLocal applies an envelope to the matching sockets of this node.
+func (manager *ClientManager) deliverLocal(env Envelope) {
+	manager.mu.RLock()
+	var targets []*Client
+	switch env.Target {
+	case TargetAll:
+		for client := range manager.Clients {
+			targets = append(targets, client)
+		}
+	case TargetUser:
+		for client := range manager.users[env.ID] {
+			targets = append(targets, client)
+		}
+	case TargetSession:
+		if client, ok := manager.sessions[env.ID]; ok {
+			targets = append(targets, client)
+		}
+	case TargetTopic:
+		for client := range manager.topics[env.ID] {
+			targets = append(targets, client)
+		}
+	}
+	manager.mu.RUnlock()
+
+	for _, client := range targets {
+		if env.Close != nil {
+			client.Disconnect(env.Close.Code, env.Close.Reason)
+			continue
+		}
+		if env.Message != nil {
+			client.sendJSON(*env.Message)
+		}
+	}
+}
+
+// revokeLocal closes the sockets of this node authenticated with revoked tokens.
+func (manager *ClientManager) revokeLocal(rev cache.Revocation) {
+	manager.mu.RLock()
+	var targets []*Client
+	if rev.SessionID != "" {
+		for client := range manager.sids[rev.SessionID] {
+			targets = append(targets, client)
+		}
+	} else {
+		for client := range manager.users[rev.UserID] {
+			targets = append(targets, client)
+		}
+	}
+	manager.mu.RUnlock()
+
+	for _, client := range targets {
+		client.Disconnect(CloseTokenRevoked, "token revoked")
+	}
+}
+
+// Draining reports whether the manager is shutting down.
+func (manager *ClientManager) Draining() bool {
+	return manager.draining.Load()
+}
+
+// startStream counts a new chat stream in, unless the manager is draining.
+// The caller must call streams.Done when the stream ends.
+func (manager *ClientManager) startStream() bool {
+	manager.drainMu.Lock()
+	defer manager.drainMu.Unlock()
+	if manager.draining.Load() {
+		return false
+	}
+	manager.streams.Add(1)
+	return true
+}
+
+// Shutdown stops accepting sockets, asks clients to reconnect elsewhere and
+// waits for in-flight streams until ctx expires. Remaining sockets are then
+// closed.
+func (manager *ClientManager) Shutdown(ctx context.Context) error {
+	// Once draining is set no stream can be added to the WaitGroup
+	manager.drainMu.Lock()
+	manager.draining.Store(true)
+	manager.drainMu.Unlock()
+
+	payload, _ := json.Marshal(protocol.SystemPayload{
+		Event:   "reconnect",
+		Message: "Server is restarting, please reconnect",
+	})
+	manager.deliverLocal(Envelope{Target: TargetAll, Message: &protocol.Message{
+		Type:    protocol.TypeSystem,
+		Payload: payload,
+	}})
+
+	done := make(chan struct{})
+	go func() {
+		manager.streams.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+		logger.Log.Info("All WebSocket streams finished")
+	case <-ctx.Done():
+		err = ctx.Err()
+		logger.Log.Warn("Timed out waiting for WebSocket streams", zap.Error(err))
+	}
+
+	manager.deliverLocal(Envelope{Target: TargetAll, Close: &CloseCommand{
+		Code:   websocket.CloseServiceRestart,
+		Reason: "server restarting",
+	}})
+	return err
+}
@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+
+	"go.uber.org/zap"
+)
+
+// options are the WebSocket settings resolved from config.WebSocketConfig.
+type options struct {
+	// Handshake
+	allowedOrigins []string
+	authTimeout    time.Duration
+
+	// Connection
+	readBufferSize    int
+	writeBufferSize   int
+	enableCompression bool
+	compressionLevel  int
+	maxMessageSize    int64         // maximum message size allowed from peer
+	writeWait         time.Duration // time allowed to write a message to the peer
+	pongWait          time.Duration // time allowed to read the next pong message from the peer
+	pingPeriod        time.Duration // send pings to peer with this period, must be less than pongWait
+
+	// Resumable streams
+	resumeTTL   time.Duration
+	resumeGrace time.Duration
+
+	// Connection limits
+	maxConns        int
+	maxConnsPerUser int
+	maxConnsPerIP   int
+	evictOldest     bool
+
+	// Backpressure
+	maxBufferedBytes  int
+	slowClientTimeout time.Duration
+}
+
+func loadOptions(cfg config.WebSocketConfig) options {
+	opts := options{
+		allowedOrigins: cfg.AllowedOrigins,
+		authTimeout:    parseTimeout("authTimeout", cfg.AuthTimeout, 10*time.Second),
+
+		readBufferSize:    cfg.ReadBufferSize,
+		writeBufferSize:   cfg.WriteBufferSize,
+		enableCompression: cfg.EnableCompression,
+		compressionLevel:  1, // flate.BestSpeed
+		maxMessageSize:    cfg.MaxMessageSize,
+		writeWait:         parseTimeout("writeWait", cfg.WriteWait, 10*time.Second),
+		pongWait:          parseTimeout("pongWait", cfg.PongWait, 60*time.Second),
+
+		resumeTTL:   parseDuration("resumeTTL", cfg.ResumeTTL, 2*time.Minute),
+		resumeGrace: parseDuration("resumeGrace", cfg.ResumeGrace, 30*time.Second),
+
+		maxConns:        cfg.MaxConns,
+		maxConnsPerUser: cfg.MaxConnsPerUser,
+		maxConnsPerIP:   cfg.MaxConnsPerIP,
+		evictOldest:     cfg.LimitPolicy == "evict_oldest",
+
+		maxBufferedBytes:  cfg.MaxBufferedBytes,
+		slowClientTimeout: parseDuration("slowClientTimeout", cfg.SlowClientTimeout, 10*time.Second),
+	}
+
+	if opts.readBufferSize <= 0 {
+		opts.readBufferSize = 4096
+	}
+	if opts.writeBufferSize <= 0 {
+		opts.writeBufferSize = 4096
+	}
+	// 0 (no compression) is a valid level, only an unset one gets the default
+	if cfg.CompressionLevel != nil {
+		opts.compressionLevel = *cfg.CompressionLevel
+	}
+	if opts.maxMessageSize <= 0 {
+		opts.maxMessageSize = 512 * 1024
+	}
+	opts.pingPeriod = parseTimeout("pingPeriod", cfg.PingPeriod, (opts.pongWait*9)/10)
+	if opts.pingPeriod >= opts.pongWait {
+		logger.Log.Warn("WebSocket pingPeriod must be less than pongWait, using default", zap.Duration("pingPeriod", opts.pingPeriod))
+		opts.pingPeriod = (opts.pongWait * 9) / 10
+	}
+	if opts.maxBufferedBytes == 0 {
+		opts.maxBufferedBytes = 1 << 20
+	}
+	return opts
+}
+
+// parseDuration parses a config duration string, falling back to def if it is
+// empty, invalid or negative. Zero is kept, it turns the feature off.
+func parseDuration(name, s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		logger.Log.Warn("Invalid WebSocket duration in config, using default",
+			zap.String("key", name), zap.String("value", s), zap.Duration("default", def))
+		return def
+	}
+	return d
+}
+
+// parseTimeout is parseDuration for deadlines and periods, which must be
+// positive: a zero deadline expires at once and a zero ticker panics.
+func parseTimeout(name, s string, def time.Duration) time.Duration {
+	d := parseDuration(name, s, def)
+	if d <= 0 {
+		logger.Log.Warn("WebSocket duration must be positive, using default",
+			zap.String("key", name), zap.String("value", s), zap.Duration("default", def))
+		return def
+	}
+	return d
+}
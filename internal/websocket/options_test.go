@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/config"
+)
+
+func TestCompressionLevel(t *testing.T) {
+	level := func(l int) *int { return &l }
+	cases := []struct {
+		name string
+		cfg  *int
+		want int
+	}{
+		{"unset", nil, 1},
+		{"no compression", level(0), 0},
+		{"huffman only", level(-2), -2},
+		{"best compression", level(9), 9},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := loadOptions(config.WebSocketConfig{CompressionLevel: tc.cfg})
+			if opts.compressionLevel != tc.want {
+				t.Fatalf("compressionLevel = %d, want %d", opts.compressionLevel, tc.want)
+			}
+		})
+	}
+}
+
+func TestDurations(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  config.WebSocketConfig
+		got  func(options) time.Duration
+		want time.Duration
+	}{
+		{"pongWait unset", config.WebSocketConfig{}, func(o options) time.Duration { return o.pongWait }, 60 * time.Second},
+		{"pongWait set", config.WebSocketConfig{PongWait: "30s"}, func(o options) time.Duration { return o.pongWait }, 30 * time.Second},
+		{"pongWait zero", config.WebSocketConfig{PongWait: "0s"}, func(o options) time.Duration { return o.pongWait }, 60 * time.Second},
+		{"pongWait negative", config.WebSocketConfig{PongWait: "-5s"}, func(o options) time.Duration { return o.pongWait }, 60 * time.Second},
+		{"pongWait invalid", config.WebSocketConfig{PongWait: "soon"}, func(o options) time.Duration { return o.pongWait }, 60 * time.Second},
+		{"pingPeriod from zero pongWait", config.WebSocketConfig{PongWait: "0s"}, func(o options) time.Duration { return o.pingPeriod }, 54 * time.Second},
+		{"pingPeriod derived", config.WebSocketConfig{PongWait: "30s"}, func(o options) time.Duration { return o.pingPeriod }, 27 * time.Second},
+		{"pingPeriod zero", config.WebSocketConfig{PingPeriod: "0s"}, func(o options) time.Duration { return o.pingPeriod }, 54 * time.Second},
+		{"pingPeriod negative", config.WebSocketConfig{PingPeriod: "-1s"}, func(o options) time.Duration { return o.pingPeriod }, 54 * time.Second},
+		{"pingPeriod above pongWait", config.WebSocketConfig{PingPeriod: "90s"}, func(o options) time.Duration { return o.pingPeriod }, 54 * time.Second},
+		{"writeWait zero", config.WebSocketConfig{WriteWait: "0s"}, func(o options) time.Duration { return o.writeWait }, 10 * time.Second},
+		{"writeWait negative", config.WebSocketConfig{WriteWait: "-10s"}, func(o options) time.Duration { return o.writeWait }, 10 * time.Second},
+		{"authTimeout zero", config.WebSocketConfig{AuthTimeout: "0s"}, func(o options) time.Duration { return o.authTimeout }, 10 * time.Second},
+		{"authTimeout negative", config.WebSocketConfig{AuthTimeout: "-1m"}, func(o options) time.Duration { return o.authTimeout }, 10 * time.Second},
+		// Zero switches these off
+		{"resumeTTL zero", config.WebSocketConfig{ResumeTTL: "0s"}, func(o options) time.Duration { return o.resumeTTL }, 0},
+		{"resumeTTL negative", config.WebSocketConfig{ResumeTTL: "-1m"}, func(o options) time.Duration { return o.resumeTTL }, 2 * time.Minute},
+		{"resumeGrace zero", config.WebSocketConfig{ResumeGrace: "0s"}, func(o options) time.Duration { return o.resumeGrace }, 0},
+		{"slowClientTimeout negative", config.WebSocketConfig{SlowClientTimeout: "-1s"}, func(o options) time.Duration { return o.slowClientTimeout }, 10 * time.Second},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.got(loadOptions(tc.cfg)); got != tc.want {
+				t.Fatalf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
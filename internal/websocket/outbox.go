@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+)
+
+// Backpressure metrics, published on /debug/vars.
+var (
+	framesCoalesced = expvar.NewInt("ws_frames_coalesced")
+	framesDropped   = expvar.NewInt("ws_frames_dropped")
+	slowDisconnects = expvar.NewInt("ws_slow_consumer_disconnects")
+)
+
+// Rough per-frame envelope overhead used for byte accounting.
+const frameOverhead = 64
+
+type outFrame struct {
+	msg protocol.Message
+	// chunk is the decoded payload of a TypeChat frame, kept so following
+	// chunks can be merged into it. Payload is re-encoded on drain.
+	chunk *protocol.ChatPayload
+	size  int
+}
+
+// outbox is the send queue of a client. Producers never block on it:
+//   - consecutive chat chunks of the same stream are coalesced into one frame
+//   - frames that would push the queue over maxBytes are dropped
+//   - frames are also dropped once the writer hasn't picked anything up for
+//     longer than maxLag
+//
+// A drop means the client is too slow to keep up; it gets disconnected and
+// can resume its streams after reconnecting.
+type outbox struct {
+	mu           sync.Mutex
+	frames       []*outFrame
+	bytes        int
+	pendingSince time.Time
+	closed       bool
+
+	maxBytes int
+	maxLag   time.Duration
+
+	// notify has capacity 1 and signals WritePump that frames are pending
+	notify chan struct{}
+}
+
+func newOutbox(maxBytes int, maxLag time.Duration) *outbox {
+	return &outbox{
+		maxBytes: maxBytes,
+		maxLag:   maxLag,
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// push queues msg. It returns false if the frame was dropped.
+func (o *outbox) push(msg protocol.Message) bool {
+	f := &outFrame{msg: msg, size: len(msg.Payload) + frameOverhead}
+	if msg.Type == protocol.TypeChat {
+		var chunk protocol.ChatPayload
+		if json.Unmarshal(msg.Payload, &chunk) == nil {
+			f.chunk = &chunk
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return true
+	}
+
+	target := o.coalesceTarget(f)
+	added := f.size
+	if target != nil {
+		added = len(f.chunk.Content)
+	}
+
+	overLimit := o.maxBytes > 0 && o.bytes+added > o.maxBytes
+	lagging := o.maxLag > 0 && !o.pendingSince.IsZero() && time.Since(o.pendingSince) > o.maxLag
+	if overLimit || lagging {
+		framesDropped.Add(1)
+		return false
+	}
+
+	if target != nil {
+		target.chunk.Content += f.chunk.Content
+		if f.msg.Seq != 0 {
+			// The merged frame stands for everything up to the newest chunk
+			target.msg.Seq = f.msg.Seq
+		}
+		target.size += added
+		framesCoalesced.Add(1)
+	} else {
+		if len(o.frames) == 0 {
+			o.pendingSince = time.Now()
+		}
+		o.frames = append(o.frames, f)
+	}
+	o.bytes += added
+	o.signal()
+	return true
+}
+
+// coalesceTarget returns the last queued frame if f is a chat chunk of the
+// same stream and chunk type, so f can be merged into it. Must be called
+// with mu held.
+func (o *outbox) coalesceTarget(f *outFrame) *outFrame {
+	if f.chunk == nil || len(o.frames) == 0 {
+		return nil
+	}
+	last := o.frames[len(o.frames)-1]
+	if last.chunk == nil ||
+		last.msg.RequestID != f.msg.RequestID ||
+		last.chunk.Type != f.chunk.Type ||
+		last.chunk.Model != f.chunk.Model {
+		return nil
+	}
+	return last
+}
+
+func (o *outbox) signal() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain takes all pending frames off the queue.
+func (o *outbox) drain() []protocol.Message {
+	o.mu.Lock()
+	frames := o.frames
+	o.frames = nil
+	o.bytes = 0
+	o.pendingSince = time.Time{}
+	o.mu.Unlock()
+
+	msgs := make([]protocol.Message, 0, len(frames))
+	for _, f := range frames {
+		if f.chunk != nil {
+			f.msg.Payload, _ = json.Marshal(f.chunk)
+		}
+		msgs = append(msgs, f.msg)
+	}
+	return msgs
+}
+
+// close discards pending frames and ignores further pushes.
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+	o.frames = nil
+	o.bytes = 0
+}
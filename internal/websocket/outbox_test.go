@@ -0,0 +1,193 @@
+package websocket
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+)
+
+func chunk(requestID string, seq int64, typ, model, content string) protocol.Message {
+	payload, _ := json.Marshal(protocol.ChatPayload{Type: typ, Model: model, Content: content})
+	return protocol.Message{Type: protocol.TypeChat, RequestID: requestID, Seq: seq, Payload: payload}
+}
+
+func decodeChunk(t *testing.T, msg protocol.Message) protocol.ChatPayload {
+	t.Helper()
+	var p protocol.ChatPayload
+	if err := json.Unmarshal(msg.Payload, &p); err != nil {
+		t.Fatalf("decode %s: %v", msg.Payload, err)
+	}
+	return p
+}
+
+func TestOutboxCoalesce(t *testing.T) {
+	cases := []struct {
+		name   string
+		second protocol.Message
+		frames int
+	}{
+		{"same stream", chunk("r1", 2, "text", "m", "b"), 1},
+		{"other request", chunk("r2", 2, "text", "m", "b"), 2},
+		{"other chunk type", chunk("r1", 2, "reasoning", "m", "b"), 2},
+		{"other model", chunk("r1", 2, "text", "m2", "b"), 2},
+		{"not a chunk", protocol.Message{Type: protocol.TypeChatEnd, RequestID: "r1", Seq: 2, Payload: json.RawMessage(`{}`)}, 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newOutbox(0, 0)
+			o.push(chunk("r1", 1, "text", "m", "a"))
+			if !o.push(tc.second) {
+				t.Fatal("frame dropped")
+			}
+			msgs := o.drain()
+			if len(msgs) != tc.frames {
+				t.Fatalf("got %d frames, want %d", len(msgs), tc.frames)
+			}
+			if tc.frames == 1 {
+				if got := decodeChunk(t, msgs[0]); got.Content != "ab" || got.Type != "text" || got.Model != "m" {
+					t.Fatalf("merged chunk %+v", got)
+				}
+				return
+			}
+			if got := decodeChunk(t, msgs[0]); got.Content != "a" {
+				t.Fatalf("first frame changed to %+v", got)
+			}
+		})
+	}
+}
+
+func TestOutboxCoalesceOnlyLastFrame(t *testing.T) {
+	o := newOutbox(0, 0)
+	o.push(chunk("r1", 1, "text", "", "a"))
+	o.push(chunk("r2", 1, "text", "", "x"))
+	o.push(chunk("r1", 2, "text", "", "b"))
+
+	// Merging into the first frame would reorder r1 and r2
+	if msgs := o.drain(); len(msgs) != 3 {
+		t.Fatalf("got %d frames, want 3", len(msgs))
+	}
+}
+
+func TestOutboxCoalesceSeq(t *testing.T) {
+	o := newOutbox(0, 0)
+	o.push(chunk("r1", 1, "text", "", "a"))
+	o.push(chunk("r1", 2, "text", "", "b"))
+	o.push(chunk("r1", 3, "text", "", "c"))
+	// Unbuffered streams carry no sequence numbers
+	o.push(chunk("r1", 0, "text", "", "d"))
+
+	msgs := o.drain()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d frames, want 1", len(msgs))
+	}
+	// A client resuming after this frame must not get b or c again
+	if msgs[0].Seq != 3 {
+		t.Fatalf("merged frame has seq %d, want 3", msgs[0].Seq)
+	}
+	if got := decodeChunk(t, msgs[0]); got.Content != "abcd" {
+		t.Fatalf("merged content %q", got.Content)
+	}
+}
+
+func TestOutboxMaxBytes(t *testing.T) {
+	content := strings.Repeat("x", 100)
+	o := newOutbox(3*(100+frameOverhead), 0)
+
+	if !o.push(protocol.Message{Type: protocol.TypeSystem, Payload: json.RawMessage(`"` + content + `"`)}) {
+		t.Fatal("dropped below the limit")
+	}
+	if !o.push(chunk("r1", 1, "text", "", content)) {
+		t.Fatal("dropped below the limit")
+	}
+	// Coalesced chunks only count their content
+	if !o.push(chunk("r1", 2, "text", "", content)) {
+		t.Fatal("dropped below the limit")
+	}
+	if o.push(protocol.Message{Type: protocol.TypeSystem, Payload: json.RawMessage(`"` + content + `"`)}) {
+		t.Fatal("frame over the limit queued")
+	}
+	if o.push(chunk("r1", 3, "text", "", strings.Repeat("x", 3*(100+frameOverhead)))) {
+		t.Fatal("chunk over the limit coalesced")
+	}
+
+	msgs := o.drain()
+	if len(msgs) != 2 {
+		t.Fatalf("got %d frames, want 2", len(msgs))
+	}
+	// The dropped chunk must not have been merged in partially
+	if msgs[1].Seq != 2 || decodeChunk(t, msgs[1]).Content != content+content {
+		t.Fatalf("unexpected last frame seq %d", msgs[1].Seq)
+	}
+
+	// Draining frees the budget
+	if !o.push(chunk("r1", 4, "text", "", content)) {
+		t.Fatal("dropped after drain")
+	}
+}
+
+func TestOutboxMaxLag(t *testing.T) {
+	o := newOutbox(0, 20*time.Millisecond)
+	if !o.push(chunk("r1", 1, "text", "", "a")) {
+		t.Fatal("dropped on an empty queue")
+	}
+	if !o.push(chunk("r2", 1, "text", "", "b")) {
+		t.Fatal("dropped before maxLag")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if o.push(chunk("r1", 2, "text", "", "c")) {
+		t.Fatal("queued while the writer lags")
+	}
+	if o.push(protocol.Message{Type: protocol.TypePong}) {
+		t.Fatal("queued while the writer lags")
+	}
+
+	// The writer caught up
+	if msgs := o.drain(); len(msgs) != 2 {
+		t.Fatalf("got %d frames, want 2", len(msgs))
+	}
+	if !o.push(chunk("r1", 3, "text", "", "d")) {
+		t.Fatal("dropped after drain")
+	}
+}
+
+func TestOutboxPushAfterClose(t *testing.T) {
+	o := newOutbox(frameOverhead, 0)
+	o.push(protocol.Message{Type: protocol.TypePong})
+	o.close()
+	<-o.notify
+
+	// Not reported as a drop, the client is gone already
+	if !o.push(chunk("r1", 1, "text", "", strings.Repeat("x", 1000))) {
+		t.Fatal("push after close reported a drop")
+	}
+	if msgs := o.drain(); len(msgs) != 0 {
+		t.Fatalf("closed outbox returned %d frames", len(msgs))
+	}
+	select {
+	case <-o.notify:
+		t.Fatal("closed outbox signalled the writer")
+	default:
+	}
+}
+
+func TestOutboxSignal(t *testing.T) {
+	o := newOutbox(0, 0)
+	o.push(chunk("r1", 1, "text", "", "a"))
+	o.push(chunk("r1", 2, "text", "", "b"))
+	o.push(protocol.Message{Type: protocol.TypePong})
+
+	select {
+	case <-o.notify:
+	default:
+		t.Fatal("writer not signalled")
+	}
+	select {
+	case <-o.notify:
+		t.Fatal("signalled more than once")
+	default:
+	}
+}
@@ -0,0 +1,269 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/yeliheng/go-ai-gateway/common/logger"
+	"github.com/yeliheng/go-ai-gateway/internal/cache"
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+
+	"go.uber.org/zap"
+)
+
+// How often a resumed stream that is still running is polled for new frames.
+const resumePollInterval = 200 * time.Millisecond
+
+// chatStream sends the frames of one request, buffering them in Redis so a
+// reconnecting client can resume the stream on any replica.
+type chatStream struct {
+	client    *Client
+	owner     string
+	requestID string
+	buffered  bool
+
+	// grace cancels the stream once its client has been gone for
+	// resumeGrace; it is stopped when a client resumes the stream.
+	mu       sync.Mutex
+	grace    *time.Timer
+	attached bool
+}
+
+// newChatStream claims requestID for the client. It returns false if the
+// request ID is already used by another stream of the same owner.
+func (c *Client) newChatStream(requestID string) (*chatStream, bool) {
+	s := &chatStream{client: c, owner: c.owner(), requestID: requestID}
+	if c.Manager.opts.resumeTTL <= 0 {
+		return s, true
+	}
+
+	ok, err := cache.ClaimStream(c.ctx, s.owner, requestID, c.Manager.opts.resumeTTL)
+	if err != nil {
+		// Not fatal, the stream just can't be resumed
+		logger.Log.Error("Failed to claim stream buffer", zap.String("request_id", requestID), zap.Error(err))
+		return s, true
+	}
+	if !ok {
+		return nil, false
+	}
+	s.buffered = true
+	return s, true
+}
+
+// owner identifies who may resume the client's streams.
+func (c *Client) owner() string {
+	if c.UserID != "" {
+		return "user:" + c.UserID
+	}
+	return "session:" + c.ID
+}
+
+func streamID(owner, requestID string) string {
+	return owner + ":" + requestID
+}
+
+// context returns the context of the stream. It is cancelled when the
+// stream is done, or resumeGrace after the client disconnects so the rest of
+// the answer can still be buffered. A stream resumed in the meantime keeps
+// running until it ends.
+func (s *chatStream) context() (context.Context, context.CancelFunc) {
+	c := s.client
+	if !s.buffered || c.Manager.opts.resumeGrace <= 0 {
+		return context.WithCancel(c.ctx)
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(c.ctx))
+	stop := context.AfterFunc(c.ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.attached {
+			s.grace = time.AfterFunc(c.Manager.opts.resumeGrace, func() { s.expire(cancel) })
+		}
+	})
+	return ctx, func() {
+		stop()
+		s.attach()
+		cancel()
+	}
+}
+
+// attach stops the grace timer, the stream has a reader again.
+func (s *chatStream) attach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attached = true
+	if s.grace != nil {
+		s.grace.Stop()
+	}
+}
+
+// expire cancels the stream unless it was resumed on another replica.
+func (s *chatStream) expire(cancel context.CancelFunc) {
+	ctx, done := context.WithTimeout(context.Background(), 2*time.Second)
+	defer done()
+	if attached, err := cache.StreamAttached(ctx, s.owner, s.requestID); err == nil && attached {
+		return
+	}
+	cancel()
+}
+
+// trackStream makes a buffered stream findable for resumes on this node.
+func (manager *ClientManager) trackStream(s *chatStream) {
+	if !s.buffered {
+		return
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.resumable[streamID(s.owner, s.requestID)] = s
+}
+
+func (manager *ClientManager) untrackStream(s *chatStream) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if manager.resumable[streamID(s.owner, s.requestID)] == s {
+		delete(manager.resumable, streamID(s.owner, s.requestID))
+	}
+}
+
+// attachStream stops the grace timer of a stream produced on this node.
+func (manager *ClientManager) attachStream(owner, requestID string) {
+	manager.mu.RLock()
+	s := manager.resumable[streamID(owner, requestID)]
+	manager.mu.RUnlock()
+	if s != nil {
+		s.attach()
+	}
+}
+
+// Send implements chat.Sink.
+func (s *chatStream) Send(msgType protocol.MessageType, payload any) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		logger.Log.Error("Failed to marshal payload", zap.Error(err))
+		return
+	}
+	msg := protocol.Message{
+		Type:      msgType,
+		RequestID: s.requestID,
+		Payload:   b,
+	}
+
+	if s.buffered {
+		frame, _ := json.Marshal(msg)
+		// Use a fresh context, the buffer must be filled even if the client is gone
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		seq, err := cache.AppendStreamFrame(ctx, s.owner, s.requestID, frame, s.client.Manager.opts.resumeTTL)
+		cancel()
+		if err != nil {
+			logger.Log.Error("Failed to buffer stream frame", zap.String("request_id", s.requestID), zap.Error(err))
+		} else {
+			msg.Seq = seq
+		}
+	}
+
+	s.client.sendJSON(msg)
+}
+
+// startResume registers that the client follows a stream. It returns false if
+// it already does, a second poller would send every frame twice.
+func (c *Client) startResume(requestID string) bool {
+	c.resumeMu.Lock()
+	defer c.resumeMu.Unlock()
+	if c.resuming[requestID] {
+		return false
+	}
+	if c.resuming == nil {
+		c.resuming = make(map[string]bool)
+	}
+	c.resuming[requestID] = true
+	return true
+}
+
+func (c *Client) endResume(requestID string) {
+	c.resumeMu.Lock()
+	defer c.resumeMu.Unlock()
+	delete(c.resuming, requestID)
+}
+
+// handleResume replays the frames of a stream after lastSeq and follows it
+// until it ends.
+func (c *Client) handleResume(requestID string, payload protocol.ResumePayload) {
+	// LRANGE would count a negative start from the tail
+	if payload.LastSeq < 0 {
+		c.sendError(requestID, 400, "last_seq must not be negative")
+		return
+	}
+	if !c.startResume(requestID) {
+		c.sendError(requestID, 409, "Stream already resumed")
+		return
+	}
+
+	owner := c.owner()
+	exists, err := cache.StreamExists(c.ctx, owner, requestID)
+	if err != nil {
+		logger.Log.Error("Failed to look up stream", zap.String("request_id", requestID), zap.Error(err))
+		c.sendError(requestID, 500, "Internal error")
+		c.endResume(requestID)
+		return
+	}
+	if !exists {
+		c.sendError(requestID, 404, "Stream not found or expired")
+		c.endResume(requestID)
+		return
+	}
+
+	// Keep the producer running, wherever it is
+	if err := cache.MarkStreamAttached(c.ctx, owner, requestID, c.Manager.opts.resumeTTL); err != nil {
+		logger.Log.Error("Failed to attach stream", zap.String("request_id", requestID), zap.Error(err))
+	}
+	c.Manager.attachStream(owner, requestID)
+
+	go func() {
+		defer c.endResume(requestID)
+		lastSeq := payload.LastSeq
+		ticker := time.NewTicker(resumePollInterval)
+		defer ticker.Stop()
+
+		for {
+			frames, err := cache.GetStreamFrames(c.ctx, owner, requestID, lastSeq)
+			if err != nil {
+				if c.ctx.Err() == nil {
+					logger.Log.Error("Failed to read stream buffer", zap.String("request_id", requestID), zap.Error(err))
+					c.sendError(requestID, 500, "Resume failed")
+				}
+				return
+			}
+
+			for _, frame := range frames {
+				var msg protocol.Message
+				if err := json.Unmarshal(frame, &msg); err != nil {
+					logger.Log.Error("Corrupt stream frame", zap.String("request_id", requestID), zap.Error(err))
+					return
+				}
+				lastSeq++
+				msg.Seq = lastSeq
+				c.sendJSON(msg)
+
+				if msg.Type == protocol.TypeChatEnd || msg.Type == protocol.TypeError {
+					return
+				}
+			}
+
+			if len(frames) == 0 {
+				// The producer stopped without an end frame and the buffer expired
+				if exists, err := cache.StreamExists(c.ctx, owner, requestID); err == nil && !exists {
+					c.sendError(requestID, 404, "Stream not found or expired")
+					return
+				}
+			}
+
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/yeliheng/go-ai-gateway/pkg/protocol"
+)
+
+// errorCodes returns the codes of the error frames queued for a client.
+func errorCodes(t *testing.T, client *Client) []int {
+	t.Helper()
+	var codes []int
+	for _, msg := range client.out.drain() {
+		if msg.Type != protocol.TypeError {
+			continue
+		}
+		var p protocol.ErrorPayload
+		if err := json.Unmarshal(msg.Payload, &p); err != nil {
+			t.Fatal(err)
+		}
+		codes = append(codes, p.Code)
+	}
+	return codes
+}
+
+func TestResumeRejectsNegativeLastSeq(t *testing.T) {
+	client := newTestClient(newTestManager(testOptions()), "a")
+
+	client.handleResume("r1", protocol.ResumePayload{LastSeq: -3})
+	if codes := errorCodes(t, client); len(codes) != 1 || codes[0] != 400 {
+		t.Fatalf("got errors %v, want [400]", codes)
+	}
+	if client.resuming["r1"] {
+		t.Fatal("rejected resume left registered")
+	}
+}
+
+func TestResumeOncePerRequest(t *testing.T) {
+	client := newTestClient(newTestManager(testOptions()), "a")
+
+	// A poller is already following r1
+	if !client.startResume("r1") {
+		t.Fatal("first resume refused")
+	}
+	client.handleResume("r1", protocol.ResumePayload{})
+	if codes := errorCodes(t, client); len(codes) != 1 || codes[0] != 409 {
+		t.Fatalf("got errors %v, want [409]", codes)
+	}
+
+	// Other streams can still be resumed
+	if !client.startResume("r2") {
+		t.Fatal("resume of another stream refused")
+	}
+
+	// Once the poller ends, the stream can be resumed again. Redis isn't
+	// reachable in tests, so the lookup fails and releases it right away.
+	client.endResume("r1")
+	client.handleResume("r1", protocol.ResumePayload{})
+	if codes := errorCodes(t, client); len(codes) != 1 || codes[0] != 500 {
+		t.Fatalf("got errors %v, want [500]", codes)
+	}
+	if !client.startResume("r1") {
+		t.Fatal("failed resume left registered")
+	}
+}
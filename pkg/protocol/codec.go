@@ -0,0 +1,106 @@
+package protocol
+
+import (
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes Messages into WebSocket frames. Clients pick one through the
+// Sec-WebSocket-Protocol header; JSON is used when none is negotiated.
+//
+// Payloads stay json.RawMessage in memory whatever the codec, so handlers
+// decode them the same way for every client.
+type Codec interface {
+	// Name is the WebSocket subprotocol that selects the codec.
+	Name() string
+	// Binary reports whether frames are sent as binary rather than text messages.
+	Binary() bool
+	Marshal(msg Message) ([]byte, error)
+	Unmarshal(data []byte, msg *Message) error
+}
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+)
+
+// Codecs lists the supported codecs in order of server preference.
+var Codecs = []Codec{MsgpackCodec, JSONCodec}
+
+// CodecFor returns the codec for a negotiated subprotocol, JSONCodec if there is none.
+func CodecFor(subprotocol string) Codec {
+	for _, codec := range Codecs {
+		if codec.Name() == subprotocol {
+			return codec
+		}
+	}
+	return JSONCodec
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Binary() bool { return false }
+
+func (jsonCodec) Marshal(msg Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec) Unmarshal(data []byte, msg *Message) error {
+	return json.Unmarshal(data, msg)
+}
+
+// msgpackMessage is the MessagePack wire form of Message, with the payload
+// encoded natively instead of as embedded JSON.
+type msgpackMessage struct {
+	Type      MessageType    `msgpack:"type"`
+	RequestID string         `msgpack:"request_id,omitempty"`
+	Seq       int64          `msgpack:"seq,omitempty"`
+	Payload   any            `msgpack:"payload"`
+	Metadata  map[string]any `msgpack:"metadata,omitempty"`
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Binary() bool { return true }
+
+func (msgpackCodec) Marshal(msg Message) ([]byte, error) {
+	wire := msgpackMessage{
+		Type:      msg.Type,
+		RequestID: msg.RequestID,
+		Seq:       msg.Seq,
+		Metadata:  msg.Metadata,
+	}
+	if len(msg.Payload) > 0 {
+		if err := json.Unmarshal(msg.Payload, &wire.Payload); err != nil {
+			return nil, err
+		}
+	}
+	return msgpack.Marshal(&wire)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, msg *Message) error {
+	var wire msgpackMessage
+	if err := msgpack.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	*msg = Message{
+		Type:      wire.Type,
+		RequestID: wire.RequestID,
+		Seq:       wire.Seq,
+		Metadata:  wire.Metadata,
+	}
+	if wire.Payload != nil {
+		payload, err := json.Marshal(wire.Payload)
+		if err != nil {
+			return err
+		}
+		msg.Payload = payload
+	}
+	return nil
+}
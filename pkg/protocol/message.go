@@ -6,20 +6,40 @@ import "encoding/json"
 type MessageType string
 
 const (
-	TypeChat   MessageType = "chat"
-	TypePing   MessageType = "ping"
-	TypePong   MessageType = "pong"
-	TypeError  MessageType = "error"
-	TypeSystem MessageType = "system"
+	TypeAuth        MessageType = "auth"
+	TypeChat        MessageType = "chat"
+	TypeChatStart   MessageType = "chat_start"
+	TypeChatEnd     MessageType = "chat_end"
+	TypeResume      MessageType = "resume"
+	TypeSubscribe   MessageType = "subscribe"
+	TypeUnsubscribe MessageType = "unsubscribe"
+	TypePing        MessageType = "ping"
+	TypePong        MessageType = "pong"
+	TypeError       MessageType = "error"
+	TypeSystem      MessageType = "system"
 )
 
 // Message is the standard envelope for all WebSocket communication.
 type Message struct {
-	Type     MessageType     `json:"type"`
+	Type MessageType `json:"type"`
+	// RequestID correlates every frame of a chat stream with the request that
+	// started it. Clients may supply one on TypeChat, otherwise the server generates it.
+	RequestID string `json:"request_id,omitempty"`
+	// Seq numbers the frames of a stream starting at 1, used to resume it after a reconnect.
+	Seq      int64           `json:"seq,omitempty"`
 	Payload  json.RawMessage `json:"payload"`
 	Metadata map[string]any  `json:"metadata,omitempty"`
 }
 
+// AuthPayload authenticates a connection that didn't present a token during
+// the handshake. It must be the first message on such a connection.
+type AuthPayload struct {
+	Token string `json:"token"`
+}
+
+// DefaultModel serves chat requests that don't name a model.
+const DefaultModel = "mock"
+
 // ChatPayload represents the content for a chat message.
 type ChatPayload struct {
 	Content string `json:"content"`
@@ -27,6 +47,43 @@ type ChatPayload struct {
 	Model   string `json:"model,omitempty"`
 }
 
+// ChatStartPayload is sent once before the first chunk of a response.
+type ChatStartPayload struct {
+	Model string `json:"model,omitempty"`
+}
+
+// ChatEndPayload is sent once after the last chunk of a response.
+type ChatEndPayload struct {
+	// FinishReason is the provider's, e.g. "stop" or "length"; empty if it
+	// didn't report one.
+	FinishReason string `json:"finish_reason"`
+	Usage        *Usage `json:"usage,omitempty"`
+}
+
+// Usage reports token consumption of a response.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ResumePayload asks the server to replay a stream (identified by the
+// message request_id) from the frame after LastSeq.
+type ResumePayload struct {
+	LastSeq int64 `json:"last_seq"`
+}
+
+// TopicPayload subscribes to or unsubscribes from a push topic.
+type TopicPayload struct {
+	Topic string `json:"topic"`
+}
+
+// SystemPayload is a server-initiated notice, e.g. a maintenance announcement.
+type SystemPayload struct {
+	Event   string `json:"event"`
+	Message string `json:"message,omitempty"`
+}
+
 // ErrorPayload represents an error message.
 type ErrorPayload struct {
 	Code    int    `json:"code"`